@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"user-crud/config"
+	"user-crud/helper"
+	"user-crud/migration"
+	"user-crud/repository"
+	"user-crud/service"
+)
+
+// Exit codes returned by Run. Errors from the service layer are mapped from
+// their helper.ErrorResponse code by exitCodeFor.
+const (
+	exitOK              = 0
+	exitFailure         = 1
+	exitUsage           = 2
+	exitShutdownTimeout = 3
+	exitInvalid         = 4
+	exitNotFound        = 5
+	exitConflict        = 6
+	exitTimeout         = 7
+)
+
+const usage = `usage: user-crud <command> [flags] [args]
+
+Commands:
+  serve                      start the HTTP API (default when no command is given)
+  migrate up|down [n]|status manage the database schema
+  seed -count N              create N random users
+  user create|get|list|update|delete
+                             manage users directly against the configured database
+
+Run "user-crud <command> -h" for the flags of a command.`
+
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Run executes the command line in args (without the program name) and
+// returns the process exit code.
+func Run(args []string) int {
+	c := &cli{stdout: os.Stdout, stderr: os.Stderr}
+	return c.run(args)
+}
+
+func (c *cli) run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return c.serve(args)
+	}
+
+	switch args[0] {
+	case "serve":
+		return c.serve(args[1:])
+	case "migrate":
+		return c.migrate(args[1:])
+	case "seed":
+		return c.seed(args[1:])
+	case "user":
+		return c.user(args[1:])
+	case "help":
+		fmt.Fprintln(c.stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		return exitUsage
+	}
+}
+
+// newFlagSet returns a flag set for a subcommand with the configuration
+// flags already registered on it.
+func (c *cli) newFlagSet(name, synopsis string) (*flag.FlagSet, *config.Loader) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: user-crud %s\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs, config.NewLoader(fs)
+}
+
+// parse parses args, allowing flags before and after positional arguments,
+// and loads the configuration.
+func (c *cli) parse(fs *flag.FlagSet, loader *config.Loader, args []string) (*config.Config, []string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, positional, nil
+}
+
+// usageError reports a command line problem and returns the exit code for it.
+func (c *cli) usageError(fs *flag.FlagSet, err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+	}
+	fs.Usage()
+	return exitUsage
+}
+
+// requireDatabase rejects the memory storage for commands that work on the
+// database directly; it lives only as long as a server does.
+func requireDatabase(cfg *config.Config) error {
+	if cfg.Storage.Type != config.StorageSQLite {
+		return fmt.Errorf("storage %q is only supported by serve", cfg.Storage.Type)
+	}
+	return nil
+}
+
+// openDatabase connects to the configured database and applies pending
+// migrations unless auto-migration is disabled.
+func openDatabase(cfg *config.Config) (*sql.DB, error) {
+	db := config.DatabaseConnection(cfg.Database)
+
+	if cfg.Database.AutoMigrate {
+		migrator, err := migration.New(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		migrator.Options.EmailRules = cfg.Email.Rules()
+		if _, err := migrator.Up(context.Background()); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// newUserRepository opens the user repository the CLI commands work on.
+func newUserRepository(db *sql.DB, cfg *config.Config) (repository.UserRepository, error) {
+	return repository.NewUserRepository(db, cfg.Email.Rules())
+}
+
+func newUserService(db *sql.DB, cfg *config.Config) (service.UserService, error) {
+	userRepository, err := newUserRepository(db, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewUserServiceImpl(userRepository), nil
+}
+
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var errorResponse *helper.ErrorResponse
+	if !errors.As(err, &errorResponse) {
+		errorResponse = helper.NewInternalErrorResponse(err, err.Error())
+	}
+
+	switch code := errorResponse.Code; {
+	case code == 404:
+		return exitNotFound
+	case code == 409:
+		return exitConflict
+	case code == 504 || code == helper.StatusClientClosedRequest:
+		return exitTimeout
+	case code >= 400 && code < 500:
+		return exitInvalid
+	default:
+		return exitFailure
+	}
+}
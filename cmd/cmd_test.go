@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"user-crud/data/response"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdout: &stdout, stderr: &stderr}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestSeedAndListUsers(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "cli.db")
+
+	code, _, stderr := runCLI(t, "seed", "-count", "5", "-db-path", dbPath)
+	assert.Equal(t, exitOK, code, stderr)
+
+	code, stdout, stderr := runCLI(t, "user", "list", "-db-path", dbPath, "-output", "json")
+	assert.Equal(t, exitOK, code, stderr)
+
+	var result struct {
+		Data []response.UserResponse `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	assert.Len(t, result.Data, 5)
+}
+
+func TestUserCommandExitCodes(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "cli.db")
+	create := []string{"user", "create", "-db-path", dbPath,
+		"-name", "John", "-surname", "Doe", "-email", "john.doe@example.com", "-phone", "05551234567"}
+
+	code, _, stderr := runCLI(t, create...)
+	assert.Equal(t, exitOK, code, stderr)
+
+	code, _, _ = runCLI(t, create...)
+	assert.Equal(t, exitConflict, code, "Duplicate email should exit with the conflict code")
+
+	code, _, _ = runCLI(t, "user", "get", "6f1c2a4e-8f0e-4d47-9a51-0d4d6c1f2b3a", "-db-path", dbPath)
+	assert.Equal(t, exitNotFound, code)
+
+	code, _, _ = runCLI(t, "user", "create", "-db-path", dbPath, "-name", "J")
+	assert.Equal(t, exitInvalid, code)
+
+	code, _, _ = runCLI(t, "user", "get", "-db-path", dbPath)
+	assert.Equal(t, exitUsage, code)
+
+	code, _, _ = runCLI(t, "bogus")
+	assert.Equal(t, exitUsage, code)
+}
+
+func TestMemoryStorageIsOnlyForServe(t *testing.T) {
+	code, _, stderr := runCLI(t, "user", "list", "-storage", "memory")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "only supported by serve")
+}
+
+func TestLoadFixture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	fixture := `[{"id": "6f1c2a4e-8f0e-4d47-9a51-0d4d6c1f2b3a", "name": "John", "surname": "Doe", "email": "john.doe@example.com", "phone_number": "05551234567"}]`
+	assert.NoError(t, os.WriteFile(path, []byte(fixture), 0o600))
+
+	users, err := loadFixture(path)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "6f1c2a4e-8f0e-4d47-9a51-0d4d6c1f2b3a", users[0].Id.String())
+
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"name": "John", "surname": "Doe", "email": "not-an-email", "phone_number": "05551234567"}]`), 0o600))
+	_, err = loadFixture(path)
+	assert.ErrorContains(t, err, "user 0")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"user-crud/data/request"
+	"user-crud/data/response"
+	"user-crud/helper"
+	"user-crud/model"
+)
+
+// loadFixture reads the users to start the memory storage with from a JSON
+// array of users shaped like the API returns them. Only name, surname, email
+// and phone_number are required, and they must pass the same validation as a
+// created user.
+func loadFixture(path string) ([]model.User, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	defer file.Close()
+
+	var fixture []response.UserResponse
+	if err := json.NewDecoder(file).Decode(&fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+
+	users := make([]model.User, len(fixture))
+	for i, user := range fixture {
+		err := helper.ValidateStruct(request.UserCreateRequest{
+			Name:        user.Name,
+			Surname:     user.Surname,
+			Email:       user.Email,
+			PhoneNumber: user.PhoneNumber,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("user %d in fixture %s is invalid: %w", i, path, err)
+		}
+
+		users[i] = model.User{
+			Id:          user.Id,
+			Name:        user.Name,
+			Surname:     user.Surname,
+			Email:       user.Email,
+			PhoneNumber: user.PhoneNumber,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			DeletedAt:   user.DeletedAt,
+			Version:     user.Version,
+		}
+	}
+
+	return users, nil
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"user-crud/config"
+	"user-crud/migration"
+)
+
+// migrate implements `user-crud migrate up|down [steps]|status|canonicalize-emails`.
+func (c *cli) migrate(args []string) int {
+	fs, loader := c.newFlagSet("migrate", "migrate [flags] up|down [steps]|status|canonicalize-emails")
+	cfg, positional, err := c.parse(fs, loader, args)
+	if err != nil {
+		return c.usageError(fs, err)
+	}
+	if err := requireDatabase(cfg); err != nil {
+		return c.usageError(fs, err)
+	}
+
+	if len(positional) == 0 {
+		return c.usageError(fs, errors.New("missing migrate action"))
+	}
+
+	steps := 1
+	switch {
+	case positional[0] == "down" && len(positional) == 2:
+		steps, err = strconv.Atoi(positional[1])
+		if err != nil || steps < 1 {
+			return c.usageError(fs, fmt.Errorf("invalid number of steps %q", positional[1]))
+		}
+	case len(positional) > 1:
+		return c.usageError(fs, fmt.Errorf("unexpected arguments %v", positional[1:]))
+	}
+
+	db := config.DatabaseConnection(cfg.Database)
+	defer db.Close()
+
+	migrator, err := migration.New(db)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	migrator.Options.EmailRules = cfg.Email.Rules()
+
+	ctx := context.Background()
+
+	switch positional[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitFailure
+		}
+		fmt.Fprintf(c.stdout, "Applied %d migration(s)\n", len(applied))
+
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitFailure
+		}
+		fmt.Fprintf(c.stdout, "Reverted %d migration(s)\n", len(reverted))
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitFailure
+		}
+		c.printMigrationStatus(statuses)
+
+	case "canonicalize-emails":
+		changed, err := migrator.CanonicalizeEmails(ctx)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitFailure
+		}
+		fmt.Fprintf(c.stdout, "Updated the canonical email of %d user(s)\n", changed)
+
+	default:
+		return c.usageError(fs, fmt.Errorf("unknown migrate action %q", positional[0]))
+	}
+
+	return exitOK
+}
+
+func (c *cli) printMigrationStatus(statuses []migration.Status) {
+	writer := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Unknown:
+			state = "unknown"
+		case status.Modified:
+			state = "modified"
+		case status.Applied:
+			state = "applied"
+		}
+
+		appliedAt := ""
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(writer, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+
+	writer.Flush()
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+	"user-crud/data/response"
+	"user-crud/helper"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func registerOutputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputTable, "output format: table or json")
+}
+
+func validateOutput(output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("invalid -output %q, expected table or json", output)
+	}
+	return nil
+}
+
+// printResult writes result as the JSON envelope used by the HTTP API, or
+// as a human readable table produced by table.
+func (c *cli) printResult(output string, result *helper.SuccessResponse, table func(w io.Writer)) {
+	if output == outputJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return
+	}
+
+	if table != nil {
+		writer := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+		table(writer)
+		writer.Flush()
+		return
+	}
+
+	fmt.Fprintln(c.stdout, result.Message)
+}
+
+// printError writes err in the requested format and returns the exit code
+// derived from its helper.ErrorResponse code.
+func (c *cli) printError(output string, err error) int {
+	var errorResponse *helper.ErrorResponse
+	if !errors.As(err, &errorResponse) {
+		errorResponse = helper.NewInternalErrorResponse(err, err.Error())
+	}
+
+	if output == outputJSON {
+		encoder := json.NewEncoder(c.stderr)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(errorResponse)
+	} else {
+		fmt.Fprintf(c.stderr, "Error: %s\n", errorResponse.Message)
+		for _, validationError := range errorResponse.Errors {
+			fmt.Fprintf(c.stderr, "  %s\n", validationError.Message)
+		}
+	}
+
+	return exitCodeFor(errorResponse)
+}
+
+// printUserTable lists users, with a DELETED AT column when any of them is
+// deleted.
+func printUserTable(users ...response.UserResponse) func(w io.Writer) {
+	return func(w io.Writer) {
+		showDeleted := false
+		for _, user := range users {
+			showDeleted = showDeleted || user.DeletedAt != nil
+		}
+
+		header := "ID\tNAME\tSURNAME\tEMAIL\tPHONE NUMBER\tCREATED AT"
+		if showDeleted {
+			header += "\tDELETED AT"
+		}
+		fmt.Fprintln(w, header)
+
+		for _, user := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s",
+				user.Id, user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt.Format(time.RFC3339))
+			if user.DeletedAt != nil {
+				fmt.Fprintf(w, "\t%s", user.DeletedAt.Format(time.RFC3339))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func printUserPage(page response.UserPageResponse) func(w io.Writer) {
+	return func(w io.Writer) {
+		printUserTable(page.Users...)(w)
+		fmt.Fprintf(w, "\nShowing %d of %d users\n", len(page.Users), page.Pagination.Total)
+		if page.Pagination.PrevCursor != "" {
+			fmt.Fprintf(w, "Previous page: -cursor %s\n", page.Pagination.PrevCursor)
+		}
+		if page.Pagination.NextCursor != "" {
+			fmt.Fprintf(w, "Next page: -cursor %s\n", page.Pagination.NextCursor)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"user-crud/data/request"
+	"user-crud/helper"
+)
+
+var (
+	seedNames    = []string{"Ahmet", "Ayşe", "Mehmet", "Fatma", "Ali", "Zeynep", "Emre", "Elif", "Burak", "Selin", "John", "Jane"}
+	seedSurnames = []string{"Yılmaz", "Kaya", "Demir", "Çelik", "Şahin", "Yıldız", "Arslan", "Doğan", "Smith", "Doe"}
+)
+
+// seed implements `user-crud seed -count N`. Users are created through the
+// service so they pass the same validation and uniqueness checks as the API.
+func (c *cli) seed(args []string) int {
+	fs, loader := c.newFlagSet("seed", "seed [flags]")
+	output := registerOutputFlag(fs)
+	count := fs.Int("count", 10, "number of users to create")
+
+	cfg, positional, err := c.parse(fs, loader, args)
+	if err != nil {
+		return c.usageError(fs, err)
+	}
+	if err := requireDatabase(cfg); err != nil {
+		return c.usageError(fs, err)
+	}
+	if err := validateOutput(*output); err != nil {
+		return c.usageError(fs, err)
+	}
+	if len(positional) > 0 {
+		return c.usageError(fs, fmt.Errorf("unexpected arguments %v", positional))
+	}
+	if *count < 1 {
+		return c.usageError(fs, errors.New("-count must be at least 1"))
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	userService, err := newUserService(db, cfg)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	ctx := context.Background()
+
+	created := 0
+	for attempts := 0; created < *count; attempts++ {
+		if attempts >= *count*10 {
+			return c.printError(*output, helper.NewErrorResponse(http.StatusConflict, "Gave up generating unique users", nil))
+		}
+
+		err := userService.Create(ctx, randomUser())
+
+		var errorResponse *helper.ErrorResponse
+		if errors.As(err, &errorResponse) && errorResponse.Code == http.StatusConflict {
+			continue
+		}
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		created++
+	}
+
+	message := fmt.Sprintf("Created %d user(s)", created)
+	c.printResult(*output, helper.NewSuccessResponse(http.StatusCreated, message, nil), nil)
+	return exitOK
+}
+
+func randomUser() request.UserCreateRequest {
+	name := seedNames[rand.IntN(len(seedNames))]
+	surname := seedSurnames[rand.IntN(len(seedSurnames))]
+	suffix := rand.IntN(1_000_000)
+
+	return request.UserCreateRequest{
+		Name:        name,
+		Surname:     surname,
+		Email:       fmt.Sprintf("%s.%s.%06d@example.com", asciiLower(name), asciiLower(surname), suffix),
+		PhoneNumber: fmt.Sprintf("05%09d", rand.IntN(1_000_000_000)),
+	}
+}
+
+// asciiLower lowercases s and drops the characters that are not valid in the
+// local part of a generated email address.
+func asciiLower(s string) string {
+	replacer := strings.NewReplacer("ı", "i", "ş", "s", "ç", "c", "ğ", "g", "ö", "o", "ü", "u", "Ç", "c", "Ş", "s")
+	s = replacer.Replace(strings.ToLower(s))
+
+	var builder strings.Builder
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
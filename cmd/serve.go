@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"user-crud/config"
+	"user-crud/controller"
+	"user-crud/helper"
+	"user-crud/middleware"
+	"user-crud/migration"
+	"user-crud/repository"
+	"user-crud/router"
+	"user-crud/service"
+)
+
+// serve starts the HTTP server and blocks until it fails or SIGINT/SIGTERM
+// is received, then drains in-flight work and closes the database.
+func (c *cli) serve(args []string) int {
+	fs, loader := c.newFlagSet("serve", "serve [flags]")
+	cfg, positional, err := c.parse(fs, loader, args)
+	if err != nil {
+		return c.usageError(fs, err)
+	}
+	if len(positional) > 0 {
+		return c.usageError(fs, fmt.Errorf("unexpected arguments %v", positional))
+	}
+
+	store := openStorage(cfg)
+	userRepository := store.users
+
+	var userCache *repository.CachedUserRepository
+	if cfg.Cache.Enabled {
+		userCache = repository.NewCachedUserRepository(userRepository, repository.CacheOptions{
+			Size:        cfg.Cache.Size,
+			TTL:         cfg.Cache.TTL,
+			NegativeTTL: cfg.Cache.NegativeTTL,
+		})
+		userRepository = userCache
+	}
+
+	userService := service.NewUserServiceImpl(userRepository)
+
+	userController := controller.NewUserController(userService)
+	userController.RequireIfMatch = cfg.Server.RequireIfMatch
+	userController.ImportChunkSize = cfg.Import.ChunkSize
+
+	auditService := service.NewAuditServiceImpl(store.audit)
+
+	auditController := controller.NewAuditController(auditService)
+
+	healthController := controller.NewHealthController(nil, nil)
+	if store.db != nil {
+		healthController.Db = store.db
+		healthController.Migrations = store.migrator
+	}
+	if userCache != nil {
+		healthController.Cache = userCache
+	}
+
+	routes := router.NewRouter(userController, auditController, healthController, middleware.RouteTimeouts{
+		Default: cfg.Server.RequestTimeout,
+		Routes:  cfg.Server.RouteTimeouts,
+	}, cfg.Server.TrustActorHeader)
+
+	corsEnabledRoutes := middleware.CORSMiddleware(cfg.CORS.AllowedOrigins)(routes)
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           corsEnabledRoutes,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	if cfg.Purge.Interval > 0 {
+		go service.NewPurger(userRepository, cfg.Purge.Retention, cfg.Purge.Interval).Run(purgeCtx)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server started on %s", cfg.Server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	exitCode := exitOK
+
+	select {
+	case err := <-serverErr:
+		log.Printf("Server stopped unexpectedly: %v", err)
+		exitCode = exitFailure
+	case <-ctx.Done():
+		log.Printf("Shutdown signal received, draining for up to %s", cfg.Server.ShutdownTimeout)
+	}
+
+	healthController.MarkShuttingDown()
+
+	// A second signal now terminates the process immediately.
+	stop()
+	stopPurge()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain HTTP connections: %v", err)
+		server.Close()
+		if exitCode == exitOK {
+			exitCode = exitShutdownTimeout
+		}
+	}
+
+	if drainer, ok := userRepository.(repository.Drainer); ok {
+		if err := drainer.Drain(shutdownCtx); err != nil {
+			log.Printf("Failed to drain repository: %v", err)
+			if exitCode == exitOK {
+				exitCode = exitShutdownTimeout
+			}
+		}
+	}
+
+	if closer, ok := userRepository.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Failed to close the user repository: %v", err)
+		}
+	}
+
+	if store.db != nil {
+		if err := store.db.Close(); err != nil {
+			log.Printf("Failed to close the database: %v", err)
+			if exitCode == exitOK {
+				exitCode = exitFailure
+			}
+		}
+	}
+
+	log.Println("Server stopped")
+	return exitCode
+}
+
+// storage is what the server keeps users in. db and migrator are only set
+// with SQLite storage.
+type storage struct {
+	db       *sql.DB
+	migrator *migration.Migrator
+	users    repository.UserRepository
+	audit    repository.AuditRepository
+}
+
+// openStorage opens the storage selected by cfg, exiting when it cannot.
+func openStorage(cfg *config.Config) storage {
+	if cfg.Storage.Type == config.StorageMemory {
+		memory := repository.NewMemoryUserRepository(cfg.Email.Rules())
+		if cfg.Storage.Fixture != "" {
+			users, err := loadFixture(cfg.Storage.Fixture)
+			helper.HandleError(err, "Failed to load the fixture")
+			helper.HandleError(memory.Load(users), "Failed to load the fixture")
+			log.Printf("Loaded %d users from %s", len(users), cfg.Storage.Fixture)
+		}
+
+		log.Println("Using in-memory storage, changes are lost when the server stops")
+		return storage{users: memory, audit: memory.AuditRepository()}
+	}
+
+	db := config.DatabaseConnection(cfg.Database)
+
+	migrator, err := migration.New(db)
+	helper.HandleError(err, "Failed to load migrations")
+	migrator.Options.EmailRules = cfg.Email.Rules()
+
+	if cfg.Database.AutoMigrate {
+		_, err = migrator.Up(context.Background())
+		helper.HandleError(err, "Failed to migrate the database")
+	}
+
+	userRepository, err := repository.NewUserRepository(db, cfg.Email.Rules())
+	helper.HandleError(err, "Failed to prepare the user repository")
+
+	return storage{db: db, migrator: migrator, users: userRepository, audit: repository.NewAuditRepository(db)}
+}
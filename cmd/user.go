@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	osuser "os/user"
+	"user-crud/data/request"
+	"user-crud/helper"
+	"user-crud/service"
+
+	"github.com/google/uuid"
+)
+
+const userSynopsis = "user create|get|list|search|update|delete|restore|purge [flags] [id|query]"
+
+// user implements `user-crud user <action>`, calling service.UserService
+// directly against the configured database.
+func (c *cli) user(args []string) int {
+	fs, loader := c.newFlagSet("user", userSynopsis)
+	output := registerOutputFlag(fs)
+	name := fs.String("name", "", "user name (create, update, list filter)")
+	surname := fs.String("surname", "", "user surname (create, update, list filter)")
+	email := fs.String("email", "", "user email (create, update)")
+	phoneNumber := fs.String("phone", "", "user phone number (create, update)")
+	limit := fs.Int("limit", 0, "maximum number of users to list (list, search)")
+	offset := fs.Int("offset", 0, "number of users to skip (list, search)")
+	cursor := fs.String("cursor", "", "cursor of the page to list (list)")
+	sort := fs.String("sort", "", "comma separated sort fields, prefix with - for descending (list)")
+	emailDomain := fs.String("email-domain", "", "only list users with this email domain (list)")
+	includeDeleted := fs.Bool("include-deleted", false, "also list deleted users that have not been purged (list)")
+	actor := fs.String("actor", defaultActor(), "actor recorded in the audit log (create, update, delete, restore)")
+
+	cfg, positional, err := c.parse(fs, loader, args)
+	if err != nil {
+		return c.usageError(fs, err)
+	}
+	if err := requireDatabase(cfg); err != nil {
+		return c.usageError(fs, err)
+	}
+	if err := validateOutput(*output); err != nil {
+		return c.usageError(fs, err)
+	}
+	if len(positional) == 0 {
+		return c.usageError(fs, errors.New("missing user action"))
+	}
+
+	action, rest := positional[0], positional[1:]
+
+	var id uuid.UUID
+	switch action {
+	case "get", "update", "delete", "restore":
+		if len(rest) != 1 {
+			return c.usageError(fs, fmt.Errorf("user %s expects exactly one user id", action))
+		}
+		id, err = uuid.Parse(rest[0])
+		if err != nil {
+			return c.printError(*output, helper.NewErrorResponse(http.StatusBadRequest, "Invalid user ID", nil))
+		}
+	case "search":
+		if len(rest) != 1 {
+			return c.usageError(fs, errors.New("user search expects exactly one query"))
+		}
+	case "create", "list", "purge":
+		if len(rest) != 0 {
+			return c.usageError(fs, fmt.Errorf("unexpected arguments %v", rest))
+		}
+	default:
+		return c.usageError(fs, fmt.Errorf("unknown user action %q", action))
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	userService, err := newUserService(db, cfg)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	ctx := helper.WithRequestInfo(context.Background(), helper.RequestInfo{Actor: *actor})
+
+	switch action {
+	case "create":
+		err := userService.Create(ctx, request.UserCreateRequest{
+			Name:        *name,
+			Surname:     *surname,
+			Email:       *email,
+			PhoneNumber: *phoneNumber,
+		})
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewSuccessResponse(http.StatusCreated, "User created successfully", nil), nil)
+
+	case "get":
+		user, err := userService.FindById(ctx, id)
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewSuccessResponse(http.StatusOK, "User found successfully", user), printUserTable(user))
+
+	case "list":
+		page, err := userService.FindAll(ctx, request.UserListRequest{
+			Limit:       *limit,
+			Offset:      *offset,
+			Cursor:      *cursor,
+			Sort:        *sort,
+			Name:        *name,
+			Surname:     *surname,
+			EmailDomain: *emailDomain,
+
+			IncludeDeleted: *includeDeleted,
+		})
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewPagedSuccessResponse(http.StatusOK, "Users fetched successfully", page.Users, page.Pagination), printUserPage(page))
+
+	case "search":
+		page, err := userService.Search(ctx, request.UserSearchRequest{Query: rest[0], Limit: *limit, Offset: *offset})
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewPagedSuccessResponse(http.StatusOK, "Users fetched successfully", page.Users, page.Pagination), printUserPage(page))
+
+	case "update":
+		user, err := userService.Update(ctx, request.UserUpdateRequest{
+			Name:        *name,
+			Surname:     *surname,
+			Email:       *email,
+			PhoneNumber: *phoneNumber,
+		}, id)
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewSuccessResponse(http.StatusOK, "User updated successfully", user), printUserTable(user))
+
+	case "delete":
+		if err := userService.Delete(ctx, id, 0); err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewSuccessResponse(http.StatusOK, "User deleted successfully", nil), nil)
+
+	case "restore":
+		user, err := userService.Restore(ctx, id)
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		c.printResult(*output, helper.NewSuccessResponse(http.StatusOK, "User restored successfully", user), printUserTable(user))
+
+	case "purge":
+		userRepository, err := newUserRepository(db, cfg)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitFailure
+		}
+		purged, err := service.NewPurger(userRepository, cfg.Purge.Retention, cfg.Purge.Interval).PurgeOnce(ctx)
+		if err != nil {
+			return c.printError(*output, err)
+		}
+		message := fmt.Sprintf("Purged %d users deleted more than %s ago", purged, cfg.Purge.Retention)
+		c.printResult(*output, helper.NewSuccessResponse(http.StatusOK, message, map[string]int64{"purged": purged}), nil)
+	}
+
+	return exitOK
+}
+
+// defaultActor names the operating system user running the CLI.
+func defaultActor() string {
+	if current, err := osuser.Current(); err == nil && current.Username != "" {
+		return "cli:" + current.Username
+	}
+	return "cli"
+}
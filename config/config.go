@@ -0,0 +1,657 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"user-crud/helper"
+
+	"gopkg.in/yaml.v3"
+)
+
+const EnvPrefix = "USER_CRUD_"
+
+type Config struct {
+	Storage  StorageConfig  `yaml:"storage"`
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Purge    PurgeConfig    `yaml:"purge"`
+	Import   ImportConfig   `yaml:"import"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Email    EmailConfig    `yaml:"email"`
+}
+
+const (
+	StorageSQLite = "sqlite"
+	StorageMemory = "memory"
+)
+
+// StorageConfig selects where users are kept. With StorageMemory the server
+// runs without a database, optionally starting from the users in Fixture,
+// and forgets every change when it stops.
+type StorageConfig struct {
+	Type    string `yaml:"type"`
+	Fixture string `yaml:"fixture"`
+}
+
+type ServerConfig struct {
+	Addr              string                   `yaml:"addr"`
+	ShutdownTimeout   time.Duration            `yaml:"shutdown_timeout"`
+	ReadHeaderTimeout time.Duration            `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration            `yaml:"write_timeout"`
+	IdleTimeout       time.Duration            `yaml:"idle_timeout"`
+	RequestTimeout    time.Duration            `yaml:"request_timeout"`
+	RouteTimeouts     map[string]time.Duration `yaml:"route_timeouts"`
+	RequireIfMatch    bool                     `yaml:"require_if_match"`
+	// TrustActorHeader takes the audit actor from the client's X-Actor
+	// header. Only enable it behind a proxy that sets or strips the header.
+	TrustActorHeader bool `yaml:"trust_actor_header"`
+}
+
+type DatabaseConfig struct {
+	Path            string        `yaml:"path"`
+	AutoMigrate     bool          `yaml:"auto_migrate"`
+	JournalMode     string        `yaml:"journal_mode"`
+	BusyTimeout     time.Duration `yaml:"busy_timeout"`
+	Synchronous     string        `yaml:"synchronous"`
+	ForeignKeys     bool          `yaml:"foreign_keys"`
+	TxLock          string        `yaml:"tx_lock"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// PurgeConfig controls how long soft-deleted users can still be restored.
+type PurgeConfig struct {
+	Retention time.Duration `yaml:"retention"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+// ImportConfig controls how CSV imports are written to the database.
+type ImportConfig struct {
+	ChunkSize int `yaml:"chunk_size"`
+}
+
+// CacheConfig controls the in-process cache of user lookups by id, email and
+// phone number.
+type CacheConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Size        int           `yaml:"size"`
+	TTL         time.Duration `yaml:"ttl"`
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+}
+
+// EmailConfig turns on the provider-specific rules used to tell whether two
+// emails are the same mailbox. Changing them on an existing database requires
+// running "migrate canonicalize-emails".
+type EmailConfig struct {
+	GmailDots bool `yaml:"gmail_dots"`
+	PlusTags  bool `yaml:"plus_tags"`
+}
+
+// Rules returns the rules for helper.CanonicalEmail.
+func (cfg EmailConfig) Rules() helper.EmailRules {
+	return helper.EmailRules{GmailDots: cfg.GmailDots, PlusTags: cfg.PlusTags}
+}
+
+func Default() *Config {
+	return &Config{
+		Storage: StorageConfig{
+			Type: StorageSQLite,
+		},
+		Server: ServerConfig{
+			Addr:              "localhost:8888",
+			ShutdownTimeout:   15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			RequestTimeout:    10 * time.Second,
+			RouteTimeouts:     map[string]time.Duration{"user.export": 10 * time.Minute, "user.import": 5 * time.Minute},
+			RequireIfMatch:    true,
+		},
+		Database: DatabaseConfig{
+			Path:            "db/test.db",
+			AutoMigrate:     true,
+			JournalMode:     "WAL",
+			BusyTimeout:     5 * time.Second,
+			Synchronous:     "NORMAL",
+			ForeignKeys:     true,
+			TxLock:          "immediate",
+			MaxOpenConns:    8,
+			MaxIdleConns:    8,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"http://localhost:3000"},
+		},
+		Purge: PurgeConfig{
+			Retention: 30 * 24 * time.Hour,
+			Interval:  time.Hour,
+		},
+		Import: ImportConfig{
+			ChunkSize: 500,
+		},
+		Cache: CacheConfig{
+			Enabled:     false,
+			Size:        10000,
+			TTL:         time.Minute,
+			NegativeTTL: 5 * time.Second,
+		},
+	}
+}
+
+// setting describes one configuration value that can be overridden from the
+// environment (EnvPrefix + env) and from the command line (-flag).
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	apply func(cfg *Config, value string) error
+}
+
+var settings = []setting{
+	{
+		flag:  "storage",
+		env:   "STORAGE",
+		usage: "where users are kept (sqlite, or memory for a database-free dev server)",
+		apply: func(cfg *Config, value string) error {
+			cfg.Storage.Type = value
+			return nil
+		},
+	},
+	{
+		flag:  "storage-fixture",
+		env:   "STORAGE_FIXTURE",
+		usage: "JSON file of users to start the memory storage with",
+		apply: func(cfg *Config, value string) error {
+			cfg.Storage.Fixture = value
+			return nil
+		},
+	},
+	{
+		flag:  "addr",
+		env:   "SERVER_ADDR",
+		usage: "HTTP listen address (host:port)",
+		apply: func(cfg *Config, value string) error {
+			cfg.Server.Addr = value
+			return nil
+		},
+	},
+	{
+		flag:  "shutdown-timeout",
+		env:   "SERVER_SHUTDOWN_TIMEOUT",
+		usage: "how long to drain in-flight requests on shutdown",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Server.ShutdownTimeout)
+		},
+	},
+	{
+		flag:  "read-header-timeout",
+		env:   "SERVER_READ_HEADER_TIMEOUT",
+		usage: "maximum time to read request headers",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Server.ReadHeaderTimeout)
+		},
+	},
+	{
+		flag:  "write-timeout",
+		env:   "SERVER_WRITE_TIMEOUT",
+		usage: "maximum time to write a response (0 disables)",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Server.WriteTimeout)
+		},
+	},
+	{
+		flag:  "idle-timeout",
+		env:   "SERVER_IDLE_TIMEOUT",
+		usage: "how long idle keep-alive connections are kept open",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Server.IdleTimeout)
+		},
+	},
+	{
+		flag:  "request-timeout",
+		env:   "SERVER_REQUEST_TIMEOUT",
+		usage: "default deadline for handling an API request",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Server.RequestTimeout)
+		},
+	},
+	{
+		flag:  "route-timeouts",
+		env:   "SERVER_ROUTE_TIMEOUTS",
+		usage: "per-route deadlines as route=duration pairs, e.g. user.list=30s",
+		apply: func(cfg *Config, value string) error {
+			return parseDurationMap(value, &cfg.Server.RouteTimeouts)
+		},
+	},
+	{
+		flag:  "require-if-match",
+		env:   "SERVER_REQUIRE_IF_MATCH",
+		usage: "reject user updates and deletes without an If-Match header",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Server.RequireIfMatch)
+		},
+	},
+	{
+		flag:  "trust-actor-header",
+		env:   "SERVER_TRUST_ACTOR_HEADER",
+		usage: "record the X-Actor header as the audit actor; only behind a proxy that sets it",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Server.TrustActorHeader)
+		},
+	},
+	{
+		flag:  "db-path",
+		env:   "DB_PATH",
+		usage: "path to the SQLite database file",
+		apply: func(cfg *Config, value string) error {
+			cfg.Database.Path = value
+			return nil
+		},
+	},
+	{
+		flag:  "auto-migrate",
+		env:   "DB_AUTO_MIGRATE",
+		usage: "apply pending schema migrations on startup",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Database.AutoMigrate)
+		},
+	},
+	{
+		flag:  "db-journal-mode",
+		env:   "DB_JOURNAL_MODE",
+		usage: "SQLite journal mode (DELETE, TRUNCATE, PERSIST, MEMORY, WAL, OFF)",
+		apply: func(cfg *Config, value string) error {
+			cfg.Database.JournalMode = value
+			return nil
+		},
+	},
+	{
+		flag:  "db-busy-timeout",
+		env:   "DB_BUSY_TIMEOUT",
+		usage: "how long SQLite waits for a lock before failing",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Database.BusyTimeout)
+		},
+	},
+	{
+		flag:  "db-synchronous",
+		env:   "DB_SYNCHRONOUS",
+		usage: "SQLite synchronous level (OFF, NORMAL, FULL, EXTRA)",
+		apply: func(cfg *Config, value string) error {
+			cfg.Database.Synchronous = value
+			return nil
+		},
+	},
+	{
+		flag:  "db-foreign-keys",
+		env:   "DB_FOREIGN_KEYS",
+		usage: "enforce foreign key constraints",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Database.ForeignKeys)
+		},
+	},
+	{
+		flag:  "db-tx-lock",
+		env:   "DB_TX_LOCK",
+		usage: "SQLite transaction locking mode (deferred, immediate, exclusive)",
+		apply: func(cfg *Config, value string) error {
+			cfg.Database.TxLock = value
+			return nil
+		},
+	},
+	{
+		flag:  "db-max-open-conns",
+		env:   "DB_MAX_OPEN_CONNS",
+		usage: "maximum number of open database connections (0 is unlimited)",
+		apply: func(cfg *Config, value string) error {
+			return parseInt(value, &cfg.Database.MaxOpenConns)
+		},
+	},
+	{
+		flag:  "db-max-idle-conns",
+		env:   "DB_MAX_IDLE_CONNS",
+		usage: "maximum number of idle database connections",
+		apply: func(cfg *Config, value string) error {
+			return parseInt(value, &cfg.Database.MaxIdleConns)
+		},
+	},
+	{
+		flag:  "db-conn-max-lifetime",
+		env:   "DB_CONN_MAX_LIFETIME",
+		usage: "maximum time a database connection is reused (0 is forever)",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Database.ConnMaxLifetime)
+		},
+	},
+	{
+		flag:  "cors-origins",
+		env:   "CORS_ALLOWED_ORIGINS",
+		usage: "comma separated list of allowed CORS origins",
+		apply: func(cfg *Config, value string) error {
+			cfg.CORS.AllowedOrigins = splitList(value)
+			return nil
+		},
+	},
+	{
+		flag:  "purge-retention",
+		env:   "PURGE_RETENTION",
+		usage: "how long deleted users can be restored before they are purged",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Purge.Retention)
+		},
+	},
+	{
+		flag:  "purge-interval",
+		env:   "PURGE_INTERVAL",
+		usage: "how often the server purges deleted users (0 disables)",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Purge.Interval)
+		},
+	},
+	{
+		flag:  "import-chunk-size",
+		env:   "IMPORT_CHUNK_SIZE",
+		usage: "number of imported users committed per transaction",
+		apply: func(cfg *Config, value string) error {
+			return parseInt(value, &cfg.Import.ChunkSize)
+		},
+	},
+	{
+		flag:  "cache",
+		env:   "CACHE_ENABLED",
+		usage: "cache user lookups by id, email and phone number",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Cache.Enabled)
+		},
+	},
+	{
+		flag:  "cache-size",
+		env:   "CACHE_SIZE",
+		usage: "maximum number of cached user lookups",
+		apply: func(cfg *Config, value string) error {
+			return parseInt(value, &cfg.Cache.Size)
+		},
+	},
+	{
+		flag:  "cache-ttl",
+		env:   "CACHE_TTL",
+		usage: "how long a cached user is served",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Cache.TTL)
+		},
+	},
+	{
+		flag:  "cache-negative-ttl",
+		env:   "CACHE_NEGATIVE_TTL",
+		usage: "how long a lookup that found no user is cached (0 disables)",
+		apply: func(cfg *Config, value string) error {
+			return parseDuration(value, &cfg.Cache.NegativeTTL)
+		},
+	},
+	{
+		flag:  "email-gmail-dots",
+		env:   "EMAIL_GMAIL_DOTS",
+		usage: "ignore dots in Gmail addresses when matching emails",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Email.GmailDots)
+		},
+	},
+	{
+		flag:  "email-plus-tags",
+		env:   "EMAIL_PLUS_TAGS",
+		usage: "ignore +tags in addresses when matching emails",
+		apply: func(cfg *Config, value string) error {
+			return parseBool(value, &cfg.Email.PlusTags)
+		},
+	},
+}
+
+// Loader builds a Config from defaults, an optional YAML file, environment
+// variables and command-line flags, in that order of precedence.
+type Loader struct {
+	configFile string
+	flagValues map[string]string
+	LookupEnv  func(key string) (string, bool)
+}
+
+// NewLoader registers the configuration flags on fs. Load must be called
+// after fs has been parsed.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	loader := &Loader{
+		flagValues: map[string]string{},
+		LookupEnv:  os.LookupEnv,
+	}
+
+	fs.StringVar(&loader.configFile, "config", "", "path to a YAML config file (env "+EnvPrefix+"CONFIG)")
+	for _, s := range settings {
+		name := s.flag
+		fs.Func(name, fmt.Sprintf("%s (env %s%s)", s.usage, EnvPrefix, s.env), func(value string) error {
+			loader.flagValues[name] = value
+			return nil
+		})
+	}
+
+	return loader
+}
+
+func (loader *Loader) Load() (*Config, error) {
+	cfg := Default()
+
+	configFile := loader.configFile
+	if configFile == "" {
+		configFile, _ = loader.LookupEnv(EnvPrefix + "CONFIG")
+	}
+
+	if configFile != "" {
+		if err := loadFile(cfg, configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := loader.LookupEnv(EnvPrefix + s.env)
+		if !ok {
+			continue
+		}
+		if err := s.apply(cfg, value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s%s: %w", EnvPrefix, s.env, err)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := loader.flagValues[s.flag]
+		if !ok {
+			continue
+		}
+		if err := s.apply(cfg, value); err != nil {
+			return nil, fmt.Errorf("invalid value for -%s: %w", s.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Load parses args as configuration flags and returns the resulting Config.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("user-crud", flag.ContinueOnError)
+	loader := NewLoader(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return loader.Load()
+}
+
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (cfg *Config) Validate() error {
+	var problems []string
+
+	switch cfg.Storage.Type {
+	case StorageSQLite:
+		if cfg.Storage.Fixture != "" {
+			problems = append(problems, "storage.fixture can only be used with storage.type memory")
+		}
+	case StorageMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("storage.type must be one of [%s %s]", StorageSQLite, StorageMemory))
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Server.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("server.addr %q is not a valid host:port", cfg.Server.Addr))
+	}
+
+	if cfg.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+
+	if cfg.Server.ReadHeaderTimeout < 0 || cfg.Server.WriteTimeout < 0 || cfg.Server.IdleTimeout < 0 {
+		problems = append(problems, "server read_header, write and idle timeouts must not be negative")
+	}
+
+	if cfg.Server.RequestTimeout <= 0 {
+		problems = append(problems, "server.request_timeout must be positive")
+	}
+
+	for route, timeout := range cfg.Server.RouteTimeouts {
+		if timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("server.route_timeouts[%s] must be positive", route))
+		}
+	}
+
+	if strings.TrimSpace(cfg.Database.Path) == "" {
+		problems = append(problems, "database.path must not be empty")
+	}
+
+	problems = append(problems, cfg.Database.validate()...)
+
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("cors.allowed_origins entry %q is not a valid origin", origin))
+		}
+	}
+
+	if cfg.Purge.Retention < 0 {
+		problems = append(problems, "purge.retention must not be negative")
+	}
+
+	if cfg.Purge.Interval < 0 {
+		problems = append(problems, "purge.interval must not be negative")
+	}
+
+	if cfg.Import.ChunkSize <= 0 {
+		problems = append(problems, "import.chunk_size must be positive")
+	}
+
+	if cfg.Cache.Enabled {
+		if cfg.Cache.Size <= 0 {
+			problems = append(problems, "cache.size must be positive")
+		}
+		if cfg.Cache.TTL <= 0 {
+			problems = append(problems, "cache.ttl must be positive")
+		}
+		if cfg.Cache.NegativeTTL < 0 {
+			problems = append(problems, "cache.negative_ttl must not be negative")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func parseDuration(value string, target *time.Duration) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*target = parsed
+	return nil
+}
+
+// parseDurationMap adds the key=duration pairs in value to target, keeping
+// the entries that value does not override.
+func parseDurationMap(value string, target *map[string]time.Duration) error {
+	parsed := map[string]time.Duration{}
+	for key, duration := range *target {
+		parsed[key] = duration
+	}
+	for _, pair := range splitList(value) {
+		key, rawDuration, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected key=duration, got %q", pair)
+		}
+
+		duration, err := time.ParseDuration(strings.TrimSpace(rawDuration))
+		if err != nil {
+			return err
+		}
+		parsed[strings.TrimSpace(key)] = duration
+	}
+	*target = parsed
+	return nil
+}
+
+func parseInt(value string, target *int) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*target = parsed
+	return nil
+}
+
+func parseBool(value string, target *bool) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*target = parsed
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"user-crud/helper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLoader(t *testing.T, args []string, env map[string]string) *Loader {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	loader.LookupEnv = func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	return loader
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := newTestLoader(t, nil, nil).Load()
+
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  addr: "0.0.0.0:9000"
+database:
+  path: "/var/lib/users/file.db"
+cors:
+  allowed_origins:
+    - "https://file.example.com"
+`)
+
+	env := map[string]string{
+		"USER_CRUD_CONFIG":               path,
+		"USER_CRUD_DB_PATH":              "/var/lib/users/env.db",
+		"USER_CRUD_CORS_ALLOWED_ORIGINS": "https://a.example.com, https://b.example.com",
+	}
+
+	cfg, err := newTestLoader(t, []string{"-cors-origins", "https://flag.example.com"}, env).Load()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0:9000", cfg.Server.Addr, "file should override defaults")
+	assert.Equal(t, "/var/lib/users/env.db", cfg.Database.Path, "env should override file")
+	assert.Equal(t, []string{"https://flag.example.com"}, cfg.CORS.AllowedOrigins, "flags should override env")
+}
+
+func TestLoadEmailRules(t *testing.T) {
+	path := writeConfigFile(t, "email:\n  gmail_dots: true\n")
+	env := map[string]string{"USER_CRUD_EMAIL_PLUS_TAGS": "true"}
+
+	cfg, err := newTestLoader(t, []string{"-config", path}, env).Load()
+
+	assert.NoError(t, err)
+	assert.Equal(t, helper.EmailRules{GmailDots: true, PlusTags: true}, cfg.Email.Rules())
+}
+
+func TestLoadTrustActorHeader(t *testing.T) {
+	cfg, err := newTestLoader(t, nil, nil).Load()
+	assert.NoError(t, err)
+	assert.False(t, cfg.Server.TrustActorHeader, "the header should not be trusted by default")
+
+	cfg, err = newTestLoader(t, []string{"-trust-actor-header=true"}, nil).Load()
+	assert.NoError(t, err)
+	assert.True(t, cfg.Server.TrustActorHeader)
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := writeConfigFile(t, "server:\n  address: \"localhost:1\"\n")
+
+	_, err := newTestLoader(t, []string{"-config", path}, nil).Load()
+
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Addr = "8888"
+	cfg.Database.Path = " "
+	cfg.CORS.AllowedOrigins = []string{"localhost:3000"}
+	cfg.Import.ChunkSize = 0
+	cfg.Cache = CacheConfig{Enabled: true}
+	cfg.Storage.Type = "postgres"
+
+	err := cfg.Validate()
+
+	assert.ErrorContains(t, err, "server.addr")
+	assert.ErrorContains(t, err, "database.path")
+	assert.ErrorContains(t, err, "cors.allowed_origins")
+	assert.ErrorContains(t, err, "import.chunk_size")
+	assert.ErrorContains(t, err, "cache.size")
+	assert.ErrorContains(t, err, "cache.ttl")
+	assert.ErrorContains(t, err, "storage.type")
+
+	cfg = Default()
+	cfg.Storage.Fixture = "users.json"
+	assert.ErrorContains(t, cfg.Validate(), "storage.fixture")
+}
@@ -2,30 +2,126 @@ package config
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
 	"user-crud/helper"
-)
 
-type DBPath string
+	_ "github.com/mattn/go-sqlite3"
+)
 
-const (
-	dbPath DBPath = "db/test.db"
+var (
+	journalModes      = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	synchronousLevels = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+	txLocks           = []string{"deferred", "immediate", "exclusive"}
 )
 
-func DatabaseConnection() *sql.DB {
-	helper.EnsureDBDirectory()
+func DatabaseConnection(cfg DatabaseConfig) *sql.DB {
+	helper.EnsureDBDirectory(filepath.Dir(cfg.Path))
 
-	db, err := sql.Open("sqlite3", string(dbPath))
+	db, err := sql.Open("sqlite3", cfg.DSN())
 	helper.HandleError(err, "Failed to connect to the database")
 
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	err = db.Ping()
 	helper.HandleError(err, "Failed to verify the database connection")
 
-	log.Println("Connected to Database")
-	
-	err = helper.CreateTableFromSQL(db)
-	helper.HandleError(err, "Failed to create the table")
+	err = verifyPragmas(db, cfg)
+	helper.HandleError(err, "Failed to apply SQLite settings")
+
+	log.Printf("Connected to Database %s (journal_mode=%s, synchronous=%s, busy_timeout=%s)",
+		cfg.Path, cfg.JournalMode, cfg.Synchronous, cfg.BusyTimeout)
+
+	return db
+}
+
+// DSN returns the go-sqlite3 connection string for cfg. The driver applies
+// these PRAGMAs to every connection it opens for the pool.
+//
+// With tx_lock=immediate every transaction takes SQLite's write lock at BEGIN.
+// Concurrent writers then queue on busy_timeout instead of failing with
+// "database is locked" when a deferred transaction tries to upgrade its lock.
+// WAL keeps plain reads from blocking on that writer.
+func (cfg DatabaseConfig) DSN() string {
+	params := url.Values{}
+	params.Set("_journal_mode", strings.ToUpper(cfg.JournalMode))
+	params.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+	params.Set("_synchronous", strings.ToUpper(cfg.Synchronous))
+	params.Set("_foreign_keys", fmt.Sprint(cfg.ForeignKeys))
+	params.Set("_txlock", strings.ToLower(cfg.TxLock))
+
+	path := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(cfg.Path)
+	return "file:" + path + "?" + params.Encode()
+}
+
+func (cfg DatabaseConfig) validate() []string {
+	var problems []string
+
+	if !slices.Contains(journalModes, strings.ToUpper(cfg.JournalMode)) {
+		problems = append(problems, fmt.Sprintf("database.journal_mode must be one of %v", journalModes))
+	}
+	if !slices.Contains(synchronousLevels, strings.ToUpper(cfg.Synchronous)) {
+		problems = append(problems, fmt.Sprintf("database.synchronous must be one of %v", synchronousLevels))
+	}
+	if !slices.Contains(txLocks, strings.ToLower(cfg.TxLock)) {
+		problems = append(problems, fmt.Sprintf("database.tx_lock must be one of %v", txLocks))
+	}
+	if cfg.BusyTimeout < 0 {
+		problems = append(problems, "database.busy_timeout must not be negative")
+	}
+	if cfg.MaxOpenConns < 0 || cfg.MaxIdleConns < 0 {
+		problems = append(problems, "database.max_open_conns and database.max_idle_conns must not be negative")
+	}
+	if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+		problems = append(problems, "database.max_idle_conns must not exceed database.max_open_conns")
+	}
+	if cfg.ConnMaxLifetime < 0 {
+		problems = append(problems, "database.conn_max_lifetime must not be negative")
+	}
+
+	return problems
+}
+
+// verifyPragmas reads the settings back from SQLite, since it silently keeps
+// its previous journal mode when the requested one is not available.
+func verifyPragmas(db *sql.DB, cfg DatabaseConfig) error {
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		return fmt.Errorf("failed to read journal_mode: %w", err)
+	}
+	if !strings.EqualFold(journalMode, cfg.JournalMode) {
+		return fmt.Errorf("journal_mode is %s, expected %s", journalMode, cfg.JournalMode)
+	}
+
+	var busyTimeout int64
+	if err := db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+		return fmt.Errorf("failed to read busy_timeout: %w", err)
+	}
+	if busyTimeout != cfg.BusyTimeout.Milliseconds() {
+		return fmt.Errorf("busy_timeout is %dms, expected %dms", busyTimeout, cfg.BusyTimeout.Milliseconds())
+	}
+
+	var synchronous int
+	if err := db.QueryRow("PRAGMA synchronous").Scan(&synchronous); err != nil {
+		return fmt.Errorf("failed to read synchronous: %w", err)
+	}
+	if expected := slices.Index(synchronousLevels, strings.ToUpper(cfg.Synchronous)); synchronous != expected {
+		return fmt.Errorf("synchronous is %d, expected %d (%s)", synchronous, expected, cfg.Synchronous)
+	}
+
+	var foreignKeys bool
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return fmt.Errorf("failed to read foreign_keys: %w", err)
+	}
+	if foreignKeys != cfg.ForeignKeys {
+		return fmt.Errorf("foreign_keys is %t, expected %t", foreignKeys, cfg.ForeignKeys)
+	}
 
-	return db;
-}
\ No newline at end of file
+	return nil
+}
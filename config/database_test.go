@@ -0,0 +1,87 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseConnectionAppliesSettings(t *testing.T) {
+	cfg := Default().Database
+	cfg.Path = filepath.Join(t.TempDir(), "settings.db")
+
+	db := DatabaseConnection(cfg)
+	defer db.Close()
+
+	var journalMode string
+	assert.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	var foreignKeys int
+	assert.NoError(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+
+	assert.Equal(t, cfg.MaxOpenConns, db.Stats().MaxOpenConnections)
+}
+
+func TestConcurrentWritesDoNotFailWithDatabaseLocked(t *testing.T) {
+	cfg := Default().Database
+	cfg.Path = filepath.Join(t.TempDir(), "concurrent.db")
+
+	db := DatabaseConnection(cfg)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE counters (id INTEGER PRIMARY KEY, value INTEGER NOT NULL)")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO counters (id, value) VALUES (1, 0)")
+	assert.NoError(t, err)
+
+	const workers, iterations = 16, 25
+	errs := make(chan error, workers*iterations)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				errs <- incrementCounter(db)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	var value int
+	assert.NoError(t, db.QueryRow("SELECT value FROM counters WHERE id = 1").Scan(&value))
+	assert.Equal(t, workers*iterations, value)
+}
+
+// incrementCounter reads before it writes, which fails with SQLITE_BUSY
+// under deferred locking when another transaction commits in between.
+func incrementCounter(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var value int
+	if err := tx.QueryRow("SELECT value FROM counters WHERE id = 1").Scan(&value); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE counters SET value = ? WHERE id = 1", value+1); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"user-crud/data/request"
+	"user-crud/helper"
+	"user-crud/service"
+)
+
+type AuditController struct {
+	AuditService service.AuditService
+}
+
+func NewAuditController(auditService service.AuditService) *AuditController {
+	return &AuditController{AuditService: auditService}
+}
+
+func (controller *AuditController) FindAll(writer http.ResponseWriter, requests *http.Request) {
+	auditListRequest, errorResponse := parseAuditListRequest(requests.URL.Query())
+	if errorResponse != nil {
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, errorResponse)
+		return
+	}
+
+	page, err := controller.AuditService.FindAll(requests.Context(), auditListRequest)
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+	successResponse := helper.NewPagedSuccessResponse(http.StatusOK, "Audit log fetched successfully", page.Entries, page.Pagination)
+	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
+}
+
+func parseAuditListRequest(query url.Values) (request.AuditListRequest, *helper.ErrorResponse) {
+	auditListRequest := request.AuditListRequest{
+		UserId: query.Get("user_id"),
+		Actor:  query.Get("actor"),
+	}
+
+	validationErrors := parseIntParameters(query, map[string]*int{"limit": &auditListRequest.Limit, "offset": &auditListRequest.Offset})
+	validationErrors = append(validationErrors, parseTimeRange(query, "from", "to", &auditListRequest.From, &auditListRequest.To)...)
+
+	if len(validationErrors) > 0 {
+		sort.Slice(validationErrors, func(i, j int) bool { return validationErrors[i].Field < validationErrors[j].Field })
+		return request.AuditListRequest{}, helper.NewErrorResponse(http.StatusBadRequest, "Invalid query parameters", validationErrors)
+	}
+
+	return auditListRequest, nil
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-crud/data/request"
+	"user-crud/data/response"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAuditService is a mock implementation of the AuditService interface
+type MockAuditService struct {
+	mock.Mock
+}
+
+func (m *MockAuditService) FindAll(ctx context.Context, req request.AuditListRequest) (response.AuditPageResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(response.AuditPageResponse), args.Error(1)
+}
+
+func TestFindAllAuditEntries(t *testing.T) {
+	mockService := new(MockAuditService)
+	controller := NewAuditController(mockService)
+
+	userId := uuid.New()
+	after := "Johnny"
+	page := response.AuditPageResponse{
+		Entries: []response.AuditResponse{
+			{Id: 1, Actor: "alice", Action: "update", UserId: userId, Changes: map[string]response.FieldChange{"name": {After: &after}}},
+		},
+		Pagination: response.Pagination{Total: 1, Limit: 10},
+	}
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 31, 23, 59, 59, int(time.Second-time.Nanosecond), time.UTC)
+	mockService.On("FindAll", mock.Anything, request.AuditListRequest{
+		Limit:  10,
+		UserId: userId.String(),
+		Actor:  "alice",
+		From:   &from,
+		To:     &to,
+	}).Return(page, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit?limit=10&actor=alice&from=2025-01-01&to=2025-01-31&user_id="+userId.String(), nil)
+	rec := httptest.NewRecorder()
+
+	controller.FindAll(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"changes":{"name":{"before":null,"after":"Johnny"}}`)
+	mockService.AssertExpectations(t)
+}
+
+func TestFindAllAuditEntriesInvalidQueryParameters(t *testing.T) {
+	mockService := new(MockAuditService)
+	controller := NewAuditController(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit?offset=x&from=yesterday", nil)
+	rec := httptest.NewRecorder()
+
+	controller.FindAll(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"from"`)
+	assert.Contains(t, rec.Body.String(), `"field":"offset"`)
+	mockService.AssertNotCalled(t, "FindAll", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"user-crud/data/response"
+	"user-crud/helper"
+	"user-crud/repository"
+)
+
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+type DatabasePinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type MigrationStatus interface {
+	Pending(ctx context.Context) (int, error)
+}
+
+type CacheStatser interface {
+	Stats() repository.CacheStats
+}
+
+type HealthController struct {
+	// Db and Migrations are nil when the server runs without a database;
+	// their checks are then left out.
+	Db           DatabasePinger
+	Migrations   MigrationStatus
+	CheckTimeout time.Duration
+
+	// Cache is the user lookup cache, or nil when caching is off.
+	Cache CacheStatser
+
+	shuttingDown atomic.Bool
+}
+
+func NewHealthController(db DatabasePinger, migrations MigrationStatus) *HealthController {
+	return &HealthController{
+		Db:           db,
+		Migrations:   migrations,
+		CheckTimeout: 2 * time.Second,
+	}
+}
+
+// MarkShuttingDown makes every following readiness probe fail.
+func (controller *HealthController) MarkShuttingDown() {
+	controller.shuttingDown.Store(true)
+}
+
+// Healthz reports that the process is up and serving HTTP.
+func (controller *HealthController) Healthz(writer http.ResponseWriter, requests *http.Request) {
+	check := runCheck("process", func() error { return nil })
+	writeHealthResponse(writer, []response.HealthCheck{check})
+}
+
+// Readyz reports whether the instance should receive traffic: the database
+// answers, every migration is applied and shutdown has not begun.
+func (controller *HealthController) Readyz(writer http.ResponseWriter, requests *http.Request) {
+	ctx, cancel := context.WithTimeout(requests.Context(), controller.CheckTimeout)
+	defer cancel()
+
+	checks := []response.HealthCheck{
+		runCheck("shutdown", func() error {
+			if controller.shuttingDown.Load() {
+				return errors.New("server is shutting down")
+			}
+			return nil
+		}),
+	}
+	if controller.Db != nil {
+		checks = append(checks, runCheck("database", func() error {
+			return controller.Db.PingContext(ctx)
+		}))
+	}
+	if controller.Migrations != nil {
+		checks = append(checks, runCheck("migrations", func() error {
+			pending, err := controller.Migrations.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d pending migration(s)", pending)
+			}
+			return nil
+		}))
+	}
+
+	writeHealthResponse(writer, checks)
+}
+
+// Cachez reports the hit and miss counters of the user lookup cache.
+func (controller *HealthController) Cachez(writer http.ResponseWriter, requests *http.Request) {
+	statsResponse := response.CacheStatsResponse{}
+	if controller.Cache != nil {
+		stats := controller.Cache.Stats()
+		statsResponse = response.CacheStatsResponse{
+			Enabled: true,
+			Hits:    stats.Hits,
+			Misses:  stats.Misses,
+			Entries: stats.Entries,
+		}
+		if lookups := stats.Hits + stats.Misses; lookups > 0 {
+			statsResponse.HitRatio = float64(stats.Hits) / float64(lookups)
+		}
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	helper.WriteJSONResponse(writer, http.StatusOK, statsResponse)
+}
+
+func runCheck(name string, check func() error) response.HealthCheck {
+	start := time.Now()
+	err := check()
+
+	result := response.HealthCheck{
+		Name:      name,
+		Status:    healthStatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = healthStatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func writeHealthResponse(writer http.ResponseWriter, checks []response.HealthCheck) {
+	healthResponse := response.HealthResponse{Status: healthStatusOK, Checks: checks}
+	statusCode := http.StatusOK
+
+	for _, check := range checks {
+		if check.Status != healthStatusOK {
+			healthResponse.Status = healthStatusFail
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	helper.WriteJSONResponse(writer, statusCode, healthResponse)
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-crud/data/response"
+	"user-crud/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (p fakePinger) PingContext(ctx context.Context) error {
+	return p.err
+}
+
+type fakeMigrationStatus struct {
+	pending int
+	err     error
+}
+
+func (m fakeMigrationStatus) Pending(ctx context.Context) (int, error) {
+	return m.pending, m.err
+}
+
+type fakeCache struct {
+	stats repository.CacheStats
+}
+
+func (c fakeCache) Stats() repository.CacheStats {
+	return c.stats
+}
+
+func decodeHealthResponse(t *testing.T, rec *httptest.ResponseRecorder) response.HealthResponse {
+	var body response.HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	return body
+}
+
+func checkStatus(body response.HealthResponse, name string) string {
+	for _, check := range body.Checks {
+		if check.Name == name {
+			return check.Status
+		}
+	}
+	return ""
+}
+
+func TestHealthz(t *testing.T) {
+	controller := NewHealthController(fakePinger{err: errors.New("down")}, fakeMigrationStatus{})
+
+	rec := httptest.NewRecorder()
+	controller.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, "Liveness must not depend on the database")
+	assert.Equal(t, "ok", decodeHealthResponse(t, rec).Status)
+}
+
+func TestReadyz(t *testing.T) {
+	controller := NewHealthController(fakePinger{}, fakeMigrationStatus{})
+
+	rec := httptest.NewRecorder()
+	controller.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	body := decodeHealthResponse(t, rec)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", body.Status)
+	assert.Len(t, body.Checks, 3)
+}
+
+func TestReadyzWithoutDatabase(t *testing.T) {
+	controller := NewHealthController(nil, nil)
+
+	rec := httptest.NewRecorder()
+	controller.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	body := decodeHealthResponse(t, rec)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, body.Checks, 1)
+	assert.Equal(t, "ok", checkStatus(body, "shutdown"))
+}
+
+func TestReadyzFailures(t *testing.T) {
+	controller := NewHealthController(fakePinger{err: errors.New("database is locked")}, fakeMigrationStatus{pending: 2})
+
+	rec := httptest.NewRecorder()
+	controller.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	body := decodeHealthResponse(t, rec)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "fail", body.Status)
+	assert.Equal(t, "fail", checkStatus(body, "database"))
+	assert.Equal(t, "fail", checkStatus(body, "migrations"))
+	assert.Equal(t, "ok", checkStatus(body, "shutdown"))
+}
+
+func TestReadyzFailsOnceShutdownBegins(t *testing.T) {
+	controller := NewHealthController(fakePinger{}, fakeMigrationStatus{})
+	controller.MarkShuttingDown()
+
+	rec := httptest.NewRecorder()
+	controller.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	body := decodeHealthResponse(t, rec)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "fail", checkStatus(body, "shutdown"))
+}
+
+func TestCachez(t *testing.T) {
+	controller := NewHealthController(fakePinger{}, fakeMigrationStatus{})
+
+	rec := httptest.NewRecorder()
+	controller.Cachez(rec, httptest.NewRequest(http.MethodGet, "/cachez", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"enabled":false,"hits":0,"misses":0,"hit_ratio":0,"entries":0}`, rec.Body.String())
+
+	controller.Cache = fakeCache{stats: repository.CacheStats{Hits: 3, Misses: 1, Entries: 1}}
+	rec = httptest.NewRecorder()
+	controller.Cachez(rec, httptest.NewRequest(http.MethodGet, "/cachez", nil))
+
+	assert.JSONEq(t, `{"enabled":true,"hits":3,"misses":1,"hit_ratio":0.75,"entries":1}`, rec.Body.String())
+}
@@ -1,8 +1,19 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 	"user-crud/data/request"
+	"user-crud/data/response"
 	"user-crud/helper"
 	"user-crud/service"
 
@@ -12,10 +23,17 @@ import (
 
 type UserController struct {
 	UserService service.UserService
+
+	// RequireIfMatch rejects updates and deletes that do not say which
+	// version of the user they were based on.
+	RequireIfMatch bool
+
+	// ImportChunkSize is how many imported users are committed at a time.
+	ImportChunkSize int
 }
 
 func NewUserController(userService service.UserService) *UserController {
-	return &UserController{UserService: userService}
+	return &UserController{UserService: userService, RequireIfMatch: true, ImportChunkSize: service.DefaultImportChunkSize}
 }
 
 func (controller *UserController) Create(writer http.ResponseWriter, requests *http.Request) {
@@ -29,23 +47,178 @@ func (controller *UserController) Create(writer http.ResponseWriter, requests *h
 	}
 
 	if err := controller.UserService.Create(requests.Context(), userCreateRequest); err != nil {
-		if errorResponse, ok := err.(*helper.ErrorResponse); ok {
-			helper.WriteJSONResponse(writer, errorResponse.Code, errorResponse)
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	successResponse := helper.NewSuccessResponse(http.StatusCreated, "User created successfully", nil)
+	helper.WriteJSONResponse(writer, http.StatusCreated, successResponse)
+}
+
+// MaxBulkCreateBytes is the largest body BulkCreate reads, enough for
+// service.MaxBulkCreateUsers users of about 4 KiB each.
+const MaxBulkCreateBytes = 4 << 20
+
+func (controller *UserController) BulkCreate(writer http.ResponseWriter, requests *http.Request) {
+	atomic := false
+	if value := requests.URL.Query().Get("atomic"); value != "" {
+		var err error
+		atomic, err = strconv.ParseBool(value)
+		if err != nil {
+			response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid query parameters", []helper.ValidationError{{
+				Field:   "atomic",
+				Tag:     "boolean",
+				Message: "Parameter 'atomic' must be true or false",
+			}})
+			helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
 			return
 		}
+	}
+
+	userCreateRequests := []request.UserCreateRequest{}
+	requests.Body = http.MaxBytesReader(writer, requests.Body, MaxBulkCreateBytes)
+	err := helper.ReadRequestBody(requests, &userCreateRequests)
+
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		response := helper.NewErrorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is larger than %d bytes", maxBytesError.Limit), nil)
+		helper.WriteJSONResponse(writer, http.StatusRequestEntityTooLarge, response)
+		return
+	}
+	if err != nil {
+		response := helper.NewErrorResponse(400, "Invalid Request Body", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
 
-		response := helper.NewErrorResponse(http.StatusInternalServerError, "Internal server error", nil)
-		helper.WriteJSONResponse(writer, http.StatusInternalServerError, response)
+	bulkResponse, err := controller.UserService.BulkCreate(requests.Context(), userCreateRequests, atomic)
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
 		return
 	}
 
-	successResponse := helper.NewSuccessResponse(http.StatusCreated, "User created successfully", nil)
-	helper.WriteJSONResponse(writer, http.StatusCreated, successResponse)
+	message := fmt.Sprintf("Created %d of %d users", bulkResponse.Created, len(bulkResponse.Results))
+	successResponse := helper.NewSuccessResponse(http.StatusMultiStatus, message, bulkResponse)
+	helper.WriteJSONResponse(writer, http.StatusMultiStatus, successResponse)
 }
 
+// MaxImportBytes is the largest CSV file Import reads.
+const MaxImportBytes = 32 << 20
+
+// Import creates users from a CSV file sent either as the request body or as
+// the "file" part of a multipart form.
+func (controller *UserController) Import(writer http.ResponseWriter, requests *http.Request) {
+	importRequest := request.UserImportRequest{ChunkSize: controller.ImportChunkSize}
+	if value := requests.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		importRequest.DryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid query parameters", []helper.ValidationError{{
+				Field:   "dry_run",
+				Tag:     "boolean",
+				Message: "Parameter 'dry_run' must be true or false",
+			}})
+			helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	// Like an export, a large import may run for as long as its route
+	// deadline allows.
+	deadline, _ := requests.Context().Deadline()
+	http.NewResponseController(writer).SetWriteDeadline(deadline)
+
+	requests.Body = http.MaxBytesReader(writer, requests.Body, MaxImportBytes)
+	file, err := importFile(requests)
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	importResponse, err := controller.UserService.Import(requests.Context(), file, importRequest)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		response := helper.NewErrorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("CSV file is larger than %d bytes", maxBytesError.Limit), nil)
+		helper.WriteJSONResponse(writer, http.StatusRequestEntityTooLarge, response)
+		return
+	}
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	message := fmt.Sprintf("Imported %d of %d users", importResponse.Created, len(importResponse.Rows))
+	if importResponse.DryRun {
+		message = fmt.Sprintf("Would import %d of %d users", importResponse.Created, len(importResponse.Rows))
+	}
+	if importResponse.StoppedAtLine != 0 {
+		message += fmt.Sprintf("; stopped at malformed line %d", importResponse.StoppedAtLine)
+	}
+	successResponse := helper.NewSuccessResponse(http.StatusMultiStatus, message, importResponse)
+	helper.WriteJSONResponse(writer, http.StatusMultiStatus, successResponse)
+}
+
+// importFile returns the CSV file sent with requests.
+func importFile(requests *http.Request) (io.Reader, error) {
+	mediaType, _, err := mime.ParseMediaType(requests.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return requests.Body, nil
+	case "multipart/form-data":
+		multipartReader, err := requests.MultipartReader()
+		if err != nil {
+			return nil, helper.NewErrorResponse(http.StatusBadRequest, "Invalid multipart body", nil)
+		}
+		for {
+			part, err := multipartReader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, helper.NewErrorResponse(http.StatusBadRequest, "Multipart body has no 'file' part", nil)
+			}
+			if err != nil {
+				return nil, helper.NewErrorResponse(http.StatusBadRequest, "Invalid multipart body", nil)
+			}
+			if part.FormName() == "file" {
+				return part, nil
+			}
+		}
+	default:
+		return nil, helper.NewErrorResponse(http.StatusUnsupportedMediaType, "Expected a text/csv or multipart/form-data body", nil)
+	}
+}
+
+// MaxPatchBytes is the largest patch Update reads.
+const MaxPatchBytes = 64 << 10
+
+// acceptPatch lists the patch formats Update accepts besides plain JSON.
+const acceptPatch = helper.MergePatchContentType + ", " + helper.JSONPatchContentType
+
+// Update changes a user. A plain JSON body sets the fields it names; a JSON
+// merge patch or JSON patch body, told apart by Content-Type, is applied to
+// the user as it is now and can also clear fields.
 func (controller *UserController) Update(writer http.ResponseWriter, requests *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(requests.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	switch mediaType {
+	case "", "application/json":
+	case helper.MergePatchContentType, helper.JSONPatchContentType:
+		controller.patch(writer, requests, mediaType)
+		return
+	default:
+		writer.Header().Set("Accept-Patch", acceptPatch)
+		response := helper.NewErrorResponse(http.StatusUnsupportedMediaType, "Expected an application/json, "+helper.MergePatchContentType+" or "+helper.JSONPatchContentType+" body", nil)
+		helper.WriteJSONResponse(writer, http.StatusUnsupportedMediaType, response)
+		return
+	}
+
 	userUpdateRequest := request.UserUpdateRequest{}
-	err := helper.ReadRequestBody(requests, &userUpdateRequest)
+	err = helper.ReadRequestBody(requests, &userUpdateRequest)
 
 	if err != nil {
 		response := helper.NewErrorResponse(400, "Invalid Request Body", nil)
@@ -62,21 +235,133 @@ func (controller *UserController) Update(writer http.ResponseWriter, requests *h
 		return
 	}
 
-	userUpdateRequest.Id = id
+	if userUpdateRequest.Id != nil && *userUpdateRequest.Id != id {
+		response := helper.NewErrorResponse(http.StatusBadRequest, "User ID in the body does not match the one in the path", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
+
+	version, ok := controller.ifMatchVersion(writer, requests)
+	if !ok {
+		return
+	}
+
+	userUpdateRequest.Id = nil
+	userUpdateRequest.Version = version
 
 	updatedUser, err := controller.UserService.Update(requests.Context(), userUpdateRequest, id)
 
 	if err != nil {
-		if errorResponse, ok := err.(*helper.ErrorResponse); ok {
-			helper.WriteJSONResponse(writer, errorResponse.Code, errorResponse)
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	writeUpdatedUser(writer, updatedUser)
+}
+
+func (controller *UserController) patch(writer http.ResponseWriter, requests *http.Request, mediaType string) {
+	userId := mux.Vars(requests)["userId"]
+	id, err := uuid.Parse(userId)
+
+	if err != nil {
+		response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid user ID", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
+
+	version, ok := controller.ifMatchVersion(writer, requests)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(writer, requests.Body, MaxPatchBytes))
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		response := helper.NewErrorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("Patch is larger than %d bytes", maxBytesError.Limit), nil)
+		helper.WriteJSONResponse(writer, http.StatusRequestEntityTooLarge, response)
+		return
+	}
+	if err != nil {
+		response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid Request Body", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
+
+	updatedUser, err := controller.UserService.Patch(requests.Context(), id, request.UserPatchRequest{
+		ContentType: mediaType,
+		Patch:       patch,
+		Version:     version,
+	})
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	writeUpdatedUser(writer, updatedUser)
+}
+
+func writeUpdatedUser(writer http.ResponseWriter, updatedUser response.UserResponse) {
+	writer.Header().Set("ETag", etag(updatedUser.Version))
+	writer.Header().Set("Last-Modified", updatedUser.UpdatedAt.UTC().Format(http.TimeFormat))
+	successResponse := helper.NewSuccessResponse(http.StatusOK, "User updated successfully", updatedUser)
+	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
+}
+
+// Replace sets every mutable field of a user, creating the user under the id
+// in the path when there is none. Without If-Match, an existing user is only
+// changed when RequireIfMatch is off.
+func (controller *UserController) Replace(writer http.ResponseWriter, requests *http.Request) {
+	userReplaceRequest := request.UserReplaceRequest{}
+	err := helper.ReadRequestBody(requests, &userReplaceRequest)
+
+	if err != nil {
+		response := helper.NewErrorResponse(400, "Invalid Request Body", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
+
+	userId := mux.Vars(requests)["userId"]
+	id, err := uuid.Parse(userId)
+
+	// The nil UUID means "no id" to the repositories, which would save the
+	// user under a new one.
+	if err != nil || id == uuid.Nil {
+		response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid user ID", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
+
+	// A missing If-Match still allows creating the user, so the service
+	// decides whether it is required. If-Match: * only matches a user that
+	// exists (RFC 7232, section 3.1).
+	switch strings.TrimSpace(requests.Header.Get("If-Match")) {
+	case "":
+		userReplaceRequest.RequireVersion = controller.RequireIfMatch
+	case "*":
+		userReplaceRequest.MustExist = true
+	default:
+		version, ok := controller.ifMatchVersion(writer, requests)
+		if !ok {
 			return
 		}
-		response := helper.NewErrorResponse(http.StatusInternalServerError, "Internal server error", nil)
-		helper.WriteJSONResponse(writer, http.StatusInternalServerError, response)
+		userReplaceRequest.Version = version
+	}
+
+	replacedUser, created, err := controller.UserService.Replace(requests.Context(), id, userReplaceRequest)
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
 		return
 	}
 
-	successResponse := helper.NewSuccessResponse(http.StatusOK, "User updated successfully", updatedUser)
+	writer.Header().Set("ETag", etag(replacedUser.Version))
+	writer.Header().Set("Last-Modified", replacedUser.UpdatedAt.UTC().Format(http.TimeFormat))
+	if created {
+		writer.Header().Set("Location", requests.URL.Path)
+		successResponse := helper.NewSuccessResponse(http.StatusCreated, "User created successfully", replacedUser)
+		helper.WriteJSONResponse(writer, http.StatusCreated, successResponse)
+		return
+	}
+	successResponse := helper.NewSuccessResponse(http.StatusOK, "User replaced successfully", replacedUser)
 	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
 }
 
@@ -90,13 +375,14 @@ func (controller *UserController) Delete(writer http.ResponseWriter, requests *h
 		return
 	}
 
-	err = controller.UserService.Delete(requests.Context(), id)
+	version, ok := controller.ifMatchVersion(writer, requests)
+	if !ok {
+		return
+	}
+
+	err = controller.UserService.Delete(requests.Context(), id, version)
 	if err != nil {
-		if errorResponse, ok := err.(*helper.ErrorResponse); ok {
-			helper.WriteJSONResponse(writer, errorResponse.Code, errorResponse)
-			return
-		}
-		helper.WriteJSONResponse(writer, http.StatusInternalServerError, helper.NewErrorResponse(500, "Internal server error", nil))
+		helper.WriteErrorResponse(writer, err)
 		return
 	}
 
@@ -105,20 +391,236 @@ func (controller *UserController) Delete(writer http.ResponseWriter, requests *h
 
 }
 
+func (controller *UserController) Restore(writer http.ResponseWriter, requests *http.Request) {
+	userId := mux.Vars(requests)["userId"]
+	id, err := uuid.Parse(userId)
+
+	if err != nil {
+		response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid user ID", nil)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
+		return
+	}
+
+	userResponse, err := controller.UserService.Restore(requests.Context(), id)
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	successResponse := helper.NewSuccessResponse(http.StatusOK, "User restored successfully", userResponse)
+	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
+}
+
 func (controller *UserController) FindAll(writer http.ResponseWriter, requests *http.Request) {
-	users, err := controller.UserService.FindAll(requests.Context())
+	userListRequest, errorResponse := parseUserListRequest(requests.URL.Query())
+	if errorResponse != nil {
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, errorResponse)
+		return
+	}
+
+	page, err := controller.UserService.FindAll(requests.Context(), userListRequest)
 	if err != nil {
-		if errorResponse, ok := err.(*helper.ErrorResponse); ok {
-			helper.WriteJSONResponse(writer, errorResponse.Code, errorResponse)
-			return
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+	successResponse := helper.NewPagedSuccessResponse(http.StatusOK, "Users fetched successfully", page.Users, page.Pagination)
+	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
+}
+
+// Export streams users as CSV or NDJSON. Once the first rows have been sent
+// the status can no longer change, so a failure after that aborts the
+// connection and the client sees a truncated download.
+func (controller *UserController) Export(writer http.ResponseWriter, requests *http.Request) {
+	exportRequest, errorResponse := parseUserExportRequest(requests.URL.Query())
+	if errorResponse != nil {
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, errorResponse)
+		return
+	}
+
+	responseController := http.NewResponseController(writer)
+
+	// The server write timeout is meant for ordinary requests; an export may
+	// write for as long as its route deadline allows.
+	deadline, _ := requests.Context().Deadline()
+	responseController.SetWriteDeadline(deadline)
+
+	if exportRequest.Format == service.ExportFormatNDJSON {
+		writer.Header().Set("Content-Type", "application/x-ndjson")
+		writer.Header().Set("Content-Disposition", `attachment; filename="users.ndjson"`)
+	} else {
+		writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+	}
+
+	stream := &flushWriter{writer: writer, controller: responseController}
+	err := controller.UserService.Export(requests.Context(), exportRequest, stream)
+	if err == nil {
+		return
+	}
+
+	if !stream.written {
+		writer.Header().Del("Content-Disposition")
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	log.Printf("User export failed after it started: %v", err)
+	panic(http.ErrAbortHandler)
+}
+
+// flushWriter sends everything written to it to the client straight away.
+type flushWriter struct {
+	writer     http.ResponseWriter
+	controller *http.ResponseController
+	written    bool
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.written = true
+	n, err := w.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, w.controller.Flush()
+}
+
+func parseUserExportRequest(query url.Values) (request.UserExportRequest, *helper.ErrorResponse) {
+	exportRequest := request.UserExportRequest{
+		Format:      query.Get("format"),
+		EmailDomain: query.Get("email_domain"),
+	}
+	if exportRequest.Format == "" {
+		exportRequest.Format = service.ExportFormatCSV
+	}
+	if value := query.Get("columns"); value != "" {
+		for _, column := range strings.Split(value, ",") {
+			exportRequest.Columns = append(exportRequest.Columns, strings.TrimSpace(column))
 		}
-		helper.WriteJSONResponse(writer, http.StatusInternalServerError, helper.NewErrorResponse(500, "Internal server error", nil))
+	}
+
+	validationErrors := parseTimeRange(query, "created_from", "created_to", &exportRequest.CreatedFrom, &exportRequest.CreatedTo)
+	if len(validationErrors) > 0 {
+		return request.UserExportRequest{}, helper.NewErrorResponse(http.StatusBadRequest, "Invalid query parameters", validationErrors)
+	}
+
+	return exportRequest, nil
+}
+
+func (controller *UserController) Search(writer http.ResponseWriter, requests *http.Request) {
+	query := requests.URL.Query()
+	userSearchRequest := request.UserSearchRequest{Query: query.Get("q")}
+
+	validationErrors := parseIntParameters(query, map[string]*int{"limit": &userSearchRequest.Limit, "offset": &userSearchRequest.Offset})
+	if len(validationErrors) > 0 {
+		response := helper.NewErrorResponse(http.StatusBadRequest, "Invalid query parameters", validationErrors)
+		helper.WriteJSONResponse(writer, http.StatusBadRequest, response)
 		return
 	}
-	successResponse := helper.NewSuccessResponse(http.StatusOK, "Users fetched successfully", users)
+
+	page, err := controller.UserService.Search(requests.Context(), userSearchRequest)
+	if err != nil {
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+	successResponse := helper.NewPagedSuccessResponse(http.StatusOK, "Users fetched successfully", page.Users, page.Pagination)
 	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
 }
 
+// parseUserListRequest reads the list parameters from the query string. Dates
+// may be given as RFC 3339 timestamps or as plain dates; a plain created_to
+// date covers that whole day.
+func parseUserListRequest(query url.Values) (request.UserListRequest, *helper.ErrorResponse) {
+	userListRequest := request.UserListRequest{
+		Cursor:      query.Get("cursor"),
+		Sort:        query.Get("sort"),
+		Name:        query.Get("name"),
+		Surname:     query.Get("surname"),
+		EmailDomain: query.Get("email_domain"),
+	}
+
+	validationErrors := parseIntParameters(query, map[string]*int{"limit": &userListRequest.Limit, "offset": &userListRequest.Offset})
+
+	if value := query.Get("include_deleted"); value != "" {
+		includeDeleted, err := strconv.ParseBool(value)
+		if err != nil {
+			validationErrors = append(validationErrors, helper.ValidationError{
+				Field:   "include_deleted",
+				Tag:     "boolean",
+				Message: "Parameter 'include_deleted' must be true or false",
+			})
+		}
+		userListRequest.IncludeDeleted = includeDeleted
+	}
+
+	validationErrors = append(validationErrors, parseTimeRange(query, "created_from", "created_to", &userListRequest.CreatedFrom, &userListRequest.CreatedTo)...)
+	validationErrors = append(validationErrors, parseTimeParameter(query, "updated_since", false, &userListRequest.UpdatedSince)...)
+
+	if len(validationErrors) > 0 {
+		sort.Slice(validationErrors, func(i, j int) bool { return validationErrors[i].Field < validationErrors[j].Field })
+		return request.UserListRequest{}, helper.NewErrorResponse(http.StatusBadRequest, "Invalid query parameters", validationErrors)
+	}
+
+	return userListRequest, nil
+}
+
+func parseIntParameters(query url.Values, targets map[string]*int) []helper.ValidationError {
+	var validationErrors []helper.ValidationError
+	for field, target := range targets {
+		value := query.Get(field)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			validationErrors = append(validationErrors, helper.ValidationError{
+				Field:   field,
+				Tag:     "number",
+				Message: fmt.Sprintf("Parameter '%s' must be an integer", field),
+			})
+			continue
+		}
+		*target = n
+	}
+
+	sort.Slice(validationErrors, func(i, j int) bool { return validationErrors[i].Field < validationErrors[j].Field })
+	return validationErrors
+}
+
+// parseTimeRange reads the fromField and toField query parameters with
+// parseTimeParameter. A date in toField includes the whole day.
+func parseTimeRange(query url.Values, fromField, toField string, from, to **time.Time) []helper.ValidationError {
+	return append(parseTimeParameter(query, fromField, false, from), parseTimeParameter(query, toField, true, to)...)
+}
+
+// parseTimeParameter reads the field query parameter as an RFC 3339 timestamp
+// or a YYYY-MM-DD date, which stands for the start of the day or, with
+// endOfDay, its last instant.
+func parseTimeParameter(query url.Values, field string, endOfDay bool, target **time.Time) []helper.ValidationError {
+	value := query.Get(field)
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return []helper.ValidationError{{
+				Field:   field,
+				Tag:     "datetime",
+				Message: fmt.Sprintf("Parameter '%s' must be an RFC 3339 timestamp or a YYYY-MM-DD date", field),
+			}}
+		}
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+	}
+
+	*target = &t
+	return nil
+}
+
 func (controller *UserController) FindById(writer http.ResponseWriter, requests *http.Request) {
 	userId := mux.Vars(requests)["userId"]
 	id, err := uuid.Parse(userId)
@@ -131,15 +633,53 @@ func (controller *UserController) FindById(writer http.ResponseWriter, requests
 
 	userResponse, err := controller.UserService.FindById(requests.Context(), id)
 	if err != nil {
-		if errorResponse, ok := err.(*helper.ErrorResponse); ok {
-			helper.WriteJSONResponse(writer, errorResponse.Code, errorResponse)
-			return
-		}
-		response := helper.NewErrorResponse(http.StatusInternalServerError, "Internal server error", nil)
-		helper.WriteJSONResponse(writer, http.StatusInternalServerError, response)
+		helper.WriteErrorResponse(writer, err)
+		return
+	}
+
+	writer.Header().Set("ETag", etag(userResponse.Version))
+	writer.Header().Set("Last-Modified", userResponse.UpdatedAt.UTC().Format(http.TimeFormat))
+
+	// Last-Modified has a resolution of one second, so the user is unchanged
+	// if it was last updated within the second given by If-Modified-Since.
+	if since, err := http.ParseTime(requests.Header.Get("If-Modified-Since")); err == nil && !userResponse.UpdatedAt.Truncate(time.Second).After(since) {
+		writer.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	successResponse := helper.NewSuccessResponse(http.StatusOK, "User found successfully", userResponse)
 	helper.WriteJSONResponse(writer, http.StatusOK, successResponse)
 }
+
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion returns the version named by the If-Match header, or zero
+// when any version is acceptable. It writes a 428 or 412 response and
+// returns false when the request cannot proceed.
+func (controller *UserController) ifMatchVersion(writer http.ResponseWriter, requests *http.Request) (int64, bool) {
+	ifMatch := strings.TrimSpace(requests.Header.Get("If-Match"))
+	if ifMatch == "" {
+		if controller.RequireIfMatch {
+			response := helper.NewErrorResponse(http.StatusPreconditionRequired, "If-Match header with the user's ETag is required", nil)
+			helper.WriteJSONResponse(writer, http.StatusPreconditionRequired, response)
+			return 0, false
+		}
+		return 0, true
+	}
+
+	if ifMatch == "*" {
+		return 0, true
+	}
+
+	// If-Match uses strong comparison, so weak or malformed tags never match.
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil || version <= 0 || ifMatch != etag(version) {
+		response := helper.NewErrorResponse(http.StatusPreconditionFailed, "If-Match does not match the user's ETag", nil)
+		helper.WriteJSONResponse(writer, http.StatusPreconditionFailed, response)
+		return 0, false
+	}
+
+	return version, true
+}
@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 	"user-crud/data/request"
 	"user-crud/data/response"
+	"user-crud/helper"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -26,19 +32,58 @@ func (m *MockUserService) Create(ctx context.Context, req request.UserCreateRequ
 	return args.Error(0)
 }
 
+func (m *MockUserService) BulkCreate(ctx context.Context, reqs []request.UserCreateRequest, atomic bool) (response.BulkCreateResponse, error) {
+	args := m.Called(ctx, reqs, atomic)
+	return args.Get(0).(response.BulkCreateResponse), args.Error(1)
+}
+
 func (m *MockUserService) Update(ctx context.Context, req request.UserUpdateRequest, userId uuid.UUID) (response.UserResponse, error) {
 	args := m.Called(ctx, req, userId)
 	return args.Get(0).(response.UserResponse), args.Error(1)
 }
 
-func (m *MockUserService) Delete(ctx context.Context, userId uuid.UUID) error {
-	args := m.Called(ctx, userId)
+func (m *MockUserService) Patch(ctx context.Context, userId uuid.UUID, req request.UserPatchRequest) (response.UserResponse, error) {
+	args := m.Called(ctx, userId, req)
+	return args.Get(0).(response.UserResponse), args.Error(1)
+}
+
+func (m *MockUserService) Replace(ctx context.Context, userId uuid.UUID, req request.UserReplaceRequest) (response.UserResponse, bool, error) {
+	args := m.Called(ctx, userId, req)
+	return args.Get(0).(response.UserResponse), args.Bool(1), args.Error(2)
+}
+
+func (m *MockUserService) Delete(ctx context.Context, userId uuid.UUID, version int64) error {
+	args := m.Called(ctx, userId, version)
 	return args.Error(0)
 }
 
-func (m *MockUserService) FindAll(ctx context.Context) ([]response.UserResponse, error) {
-	args := m.Called(ctx)
-	return args.Get(0).([]response.UserResponse), args.Error(1)
+func (m *MockUserService) Export(ctx context.Context, req request.UserExportRequest, writer io.Writer) error {
+	args := m.Called(ctx, req, writer)
+	return args.Error(0)
+}
+
+func (m *MockUserService) Import(ctx context.Context, reader io.Reader, req request.UserImportRequest) (response.UserImportResponse, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return response.UserImportResponse{}, err
+	}
+	args := m.Called(ctx, string(data), req)
+	return args.Get(0).(response.UserImportResponse), args.Error(1)
+}
+
+func (m *MockUserService) FindAll(ctx context.Context, req request.UserListRequest) (response.UserPageResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(response.UserPageResponse), args.Error(1)
+}
+
+func (m *MockUserService) Restore(ctx context.Context, userId uuid.UUID) (response.UserResponse, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(response.UserResponse), args.Error(1)
+}
+
+func (m *MockUserService) Search(ctx context.Context, req request.UserSearchRequest) (response.UserPageResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(response.UserPageResponse), args.Error(1)
 }
 
 func (m *MockUserService) FindById(ctx context.Context, userId uuid.UUID) (response.UserResponse, error) {
@@ -70,13 +115,152 @@ func TestCreateUser(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestBulkCreateUsers(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	reqBody := []request.UserCreateRequest{
+		{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"},
+		{Name: "Jane", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "0987654321"},
+	}
+	body, _ := json.Marshal(reqBody)
+
+	id := uuid.New()
+	result := response.BulkCreateResponse{
+		Results: []response.BulkCreateResult{
+			{Index: 0, Status: http.StatusCreated, Id: &id},
+			{Index: 1, Status: http.StatusConflict, Error: helper.NewErrorResponse(http.StatusConflict, "User 0 in this batch has the same email", nil)},
+		},
+		Created: 1,
+		Failed:  1,
+	}
+	mockService.On("BulkCreate", mock.Anything, reqBody, true).Return(result, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/bulk?atomic=true", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	controller.BulkCreate(rec, req)
+
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"message":"Created 1 of 2 users"`)
+	assert.Contains(t, rec.Body.String(), `"error":{"code":409,"message":"User 0 in this batch has the same email"}`)
+	mockService.AssertExpectations(t)
+}
+
+func TestBulkCreateUsersInvalidRequest(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	for _, target := range []string{"/api/v1/user/bulk?atomic=maybe", "/api/v1/user/bulk"} {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader([]byte(`{"name":"John"}`)))
+		rec := httptest.NewRecorder()
+
+		controller.BulkCreate(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+	mockService.AssertNotCalled(t, "BulkCreate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBulkCreateUsersTooLarge(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	body := `[{"name":"` + strings.Repeat("a", MaxBulkCreateBytes) + `"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/bulk", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	controller.BulkCreate(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), fmt.Sprintf("Request body is larger than %d bytes", MaxBulkCreateBytes))
+	mockService.AssertNotCalled(t, "BulkCreate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestImportUsers(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	csvBody := "name,surname,email,phone_number\nJohn,Doe,john.doe@example.com,1234567890\n"
+	id := uuid.New()
+	result := response.UserImportResponse{
+		DryRun:  true,
+		Rows:    []response.ImportRowResult{{Line: 2, Status: http.StatusCreated, Id: &id}},
+		Created: 1,
+	}
+	mockService.On("Import", mock.Anything, csvBody, request.UserImportRequest{DryRun: true, ChunkSize: 500}).Return(result, nil).Twice()
+
+	var multipartBody bytes.Buffer
+	form := multipart.NewWriter(&multipartBody)
+	form.WriteField("comment", "ignored")
+	part, _ := form.CreateFormFile("file", "users.csv")
+	part.Write([]byte(csvBody))
+	form.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{"raw", "text/csv; charset=utf-8", []byte(csvBody)},
+		{"multipart", form.FormDataContentType(), multipartBody.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/user/import?dry_run=true", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+
+			controller.Import(rec, req)
+
+			assert.Equal(t, http.StatusMultiStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"message":"Would import 1 of 1 users"`)
+			assert.Contains(t, rec.Body.String(), `"line":2`)
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestImportUsersInvalidRequest(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		status      int
+	}{
+		{"json body", "/api/v1/user/import", "application/json", http.StatusUnsupportedMediaType},
+		{"no content type", "/api/v1/user/import", "", http.StatusUnsupportedMediaType},
+		{"invalid dry_run", "/api/v1/user/import?dry_run=maybe", "text/csv", http.StatusBadRequest},
+		{"multipart without file", "/api/v1/user/import", "multipart/form-data; boundary=x", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewReader([]byte("--x--\r\n")))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			controller.Import(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+	mockService.AssertNotCalled(t, "Import", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestUpdateUser(t *testing.T) {
 	mockService := new(MockUserService)
 	controller := NewUserController(mockService)
 
 	userId := uuid.New()
 	reqBody := request.UserUpdateRequest{
-		Id:          userId,
 		Name:        "John Updated",
 		Surname:     "Doe Updated",
 		Email:       "john.updated@example.com",
@@ -85,17 +269,19 @@ func TestUpdateUser(t *testing.T) {
 	body, _ := json.Marshal(reqBody)
 
 	updatedUser := response.UserResponse{
-		Id:          userId,
 		Name:        "John Updated",
 		Surname:     "Doe Updated",
 		Email:       "john.updated@example.com",
 		PhoneNumber: "987654321",
+		Version:     4,
 	}
 
+	reqBody.Version = 3
 	mockService.On("Update", mock.Anything, reqBody, userId).Return(updatedUser, nil)
 
 	req := httptest.NewRequest(http.MethodPut, "/users/"+userId.String(), bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"3"`)
 	rec := httptest.NewRecorder()
 
 	vars := map[string]string{"userId": userId.String()}
@@ -104,18 +290,205 @@ func TestUpdateUser(t *testing.T) {
 	controller.Update(rec, req)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
 	mockService.AssertExpectations(t)
 }
 
+func TestUpdateUserBodyId(t *testing.T) {
+	userId := uuid.New()
+
+	tests := []struct {
+		name   string
+		bodyId uuid.UUID
+		status int
+	}{
+		{"same as path", userId, http.StatusOK},
+		{"different from path", uuid.New(), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockUserService)
+			controller := NewUserController(mockService)
+			mockService.On("Update", mock.Anything, request.UserUpdateRequest{Name: "John", Version: 3}, userId).Return(response.UserResponse{Id: userId, Version: 4}, nil)
+
+			body := `{"id":"` + tt.bodyId.String() + `","name":"John"}`
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/user/"+userId.String(), strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", `"3"`)
+			req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+			rec := httptest.NewRecorder()
+
+			controller.Update(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status != http.StatusOK {
+				mockService.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	userId := uuid.New()
+
+	tests := []struct {
+		contentType string
+		mediaType   string
+		patch       string
+	}{
+		{"application/merge-patch+json", helper.MergePatchContentType, `{"phone_number":null}`},
+		{"application/json-patch+json; charset=utf-8", helper.JSONPatchContentType, `[{"op":"test","path":"/name","value":"John"},{"op":"replace","path":"/name","value":"Jane"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			mockService := new(MockUserService)
+			controller := NewUserController(mockService)
+
+			patchRequest := request.UserPatchRequest{ContentType: tt.mediaType, Patch: []byte(tt.patch), Version: 3}
+			mockService.On("Patch", mock.Anything, userId, patchRequest).Return(response.UserResponse{Id: userId, Version: 4}, nil)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/user/"+userId.String(), strings.NewReader(tt.patch))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("If-Match", `"3"`)
+			req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+			rec := httptest.NewRecorder()
+
+			controller.Update(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchUserInvalidRequest(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+	userId := uuid.New()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unsupported content type", "text/plain", "name=Jane", http.StatusUnsupportedMediaType},
+		{"patch too large", helper.MergePatchContentType, `{"name":"` + strings.Repeat("a", MaxPatchBytes) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/user/"+userId.String(), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("If-Match", `"3"`)
+			req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+			rec := httptest.NewRecorder()
+
+			controller.Update(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+	mockService.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything)
+	mockService.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReplaceUser(t *testing.T) {
+	userId := uuid.New()
+	body := `{"name":"John","surname":"Doe","email":"john.doe@example.com","phone_number":"5550000001"}`
+	replaceRequest := request.UserReplaceRequest{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001"}
+
+	tests := []struct {
+		name     string
+		ifMatch  string
+		expected request.UserReplaceRequest
+		created  bool
+		status   int
+	}{
+		{"create without If-Match", "", request.UserReplaceRequest{RequireVersion: true}, true, http.StatusCreated},
+		{"replace with If-Match", `"3"`, request.UserReplaceRequest{Version: 3}, false, http.StatusOK},
+		{"replace with any version", "*", request.UserReplaceRequest{MustExist: true}, false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockUserService)
+			controller := NewUserController(mockService)
+
+			expected := replaceRequest
+			expected.Version = tt.expected.Version
+			expected.RequireVersion = tt.expected.RequireVersion
+			expected.MustExist = tt.expected.MustExist
+			mockService.On("Replace", mock.Anything, userId, expected).Return(response.UserResponse{Id: userId, Version: 4}, tt.created, nil)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/user/"+userId.String(), strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+			rec := httptest.NewRecorder()
+
+			controller.Replace(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+			if tt.created {
+				assert.Equal(t, "/api/v1/user/"+userId.String(), rec.Header().Get("Location"))
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReplaceUserInvalidRequest(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+	userId := uuid.New()
+
+	tests := []struct {
+		name    string
+		userId  string
+		body    string
+		ifMatch string
+		status  int
+	}{
+		{"invalid id", "42", `{"name":"John"}`, "", http.StatusBadRequest},
+		{"nil id", uuid.Nil.String(), `{"name":"John","surname":"Doe","email":"john.doe@example.com","phone_number":"1234567890"}`, "", http.StatusBadRequest},
+		{"unknown field", userId.String(), `{"id":"` + userId.String() + `","name":"John"}`, "", http.StatusBadRequest},
+		{"malformed If-Match", userId.String(), `{"name":"John"}`, `W/"3"`, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/user/"+tt.userId, strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			req = mux.SetURLVars(req, map[string]string{"userId": tt.userId})
+			rec := httptest.NewRecorder()
+
+			controller.Replace(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+	mockService.AssertNotCalled(t, "Replace", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestDeleteUser(t *testing.T) {
 	mockService := new(MockUserService)
 	controller := NewUserController(mockService)
 
 	userId := uuid.New()
 
-	mockService.On("Delete", mock.Anything, userId).Return(nil)
+	mockService.On("Delete", mock.Anything, userId, int64(2)).Return(nil)
 
 	req := httptest.NewRequest(http.MethodDelete, "/users/"+userId.String(), nil)
+	req.Header.Set("If-Match", `"2"`)
 	rec := httptest.NewRecorder()
 
 	vars := map[string]string{"userId": userId.String()}
@@ -127,6 +500,47 @@ func TestDeleteUser(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestDeleteUserPreconditions(t *testing.T) {
+	userId := uuid.New()
+
+	tests := []struct {
+		name           string
+		ifMatch        string
+		requireIfMatch bool
+		expectedCode   int
+	}{
+		{name: "missing", requireIfMatch: true, expectedCode: http.StatusPreconditionRequired},
+		{name: "weak", ifMatch: `W/"2"`, requireIfMatch: true, expectedCode: http.StatusPreconditionFailed},
+		{name: "unquoted", ifMatch: "2", requireIfMatch: true, expectedCode: http.StatusPreconditionFailed},
+		{name: "wildcard", ifMatch: "*", requireIfMatch: true, expectedCode: http.StatusOK},
+		{name: "optional", requireIfMatch: false, expectedCode: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockService := new(MockUserService)
+			controller := NewUserController(mockService)
+			controller.RequireIfMatch = test.requireIfMatch
+
+			if test.expectedCode == http.StatusOK {
+				mockService.On("Delete", mock.Anything, userId, int64(0)).Return(nil)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+userId.String(), nil)
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+			rec := httptest.NewRecorder()
+
+			controller.Delete(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestFindAllUsers(t *testing.T) {
 	mockService := new(MockUserService)
 	controller := NewUserController(mockService)
@@ -148,7 +562,11 @@ func TestFindAllUsers(t *testing.T) {
 		},
 	}
 
-	mockService.On("FindAll", mock.Anything).Return(users, nil)
+	page := response.UserPageResponse{
+		Users:      users,
+		Pagination: response.Pagination{Total: 5, Limit: 2, NextCursor: "next"},
+	}
+	mockService.On("FindAll", mock.Anything, request.UserListRequest{}).Return(page, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/users", nil)
 	rec := httptest.NewRecorder()
@@ -156,16 +574,69 @@ func TestFindAllUsers(t *testing.T) {
 	controller.FindAll(rec, req)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Data       []response.UserResponse `json:"data"`
+		Pagination response.Pagination     `json:"pagination"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 2)
+	assert.Equal(t, page.Pagination, body.Pagination)
 	mockService.AssertExpectations(t)
 }
 
+func TestFindAllUsersQueryParameters(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 23, 59, 59, 999999999, time.UTC)
+	expected := request.UserListRequest{
+		Limit:       10,
+		Offset:      20,
+		Sort:        "surname,-created_at",
+		Name:        "John",
+		EmailDomain: "example.com",
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+
+		UpdatedSince: &from,
+
+		IncludeDeleted: true,
+	}
+	mockService.On("FindAll", mock.Anything, expected).Return(response.UserPageResponse{Users: []response.UserResponse{}}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?limit=10&offset=20&sort=surname,-created_at&name=John&email_domain=example.com&created_from=2024-01-01T00:00:00Z&created_to=2024-01-31&updated_since=2024-01-01&include_deleted=true", nil)
+	rec := httptest.NewRecorder()
+
+	controller.FindAll(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"data":[]`)
+	mockService.AssertExpectations(t)
+}
+
+func TestFindAllUsersInvalidQueryParameters(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?limit=ten&created_from=yesterday", nil)
+	rec := httptest.NewRecorder()
+
+	controller.FindAll(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "created_from")
+	assert.Contains(t, rec.Body.String(), "limit")
+	mockService.AssertNotCalled(t, "FindAll", mock.Anything, mock.Anything)
+}
+
 func TestFindUserById(t *testing.T) {
 	mockService := new(MockUserService)
 	controller := NewUserController(mockService)
 
 	userId := uuid.New()
 	user := response.UserResponse{
-		Id:          userId,
 		Name:        "John",
 		Surname:     "Doe",
 		Email:       "john.doe@example.com",
@@ -185,3 +656,163 @@ func TestFindUserById(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 	mockService.AssertExpectations(t)
 }
+
+func TestFindUserByIdNotModified(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	userId := uuid.New()
+	updatedAt := time.Date(2025, 3, 1, 12, 30, 15, 500000000, time.UTC)
+	mockService.On("FindById", mock.Anything, userId).Return(response.UserResponse{Id: userId, UpdatedAt: updatedAt}, nil)
+
+	tests := []struct {
+		name            string
+		ifModifiedSince string
+		expectedCode    int
+	}{
+		{name: "same second", ifModifiedSince: "Sat, 01 Mar 2025 12:30:15 GMT", expectedCode: http.StatusNotModified},
+		{name: "later", ifModifiedSince: "Sun, 02 Mar 2025 00:00:00 GMT", expectedCode: http.StatusNotModified},
+		{name: "earlier", ifModifiedSince: "Sat, 01 Mar 2025 12:30:14 GMT", expectedCode: http.StatusOK},
+		{name: "invalid", ifModifiedSince: "yesterday", expectedCode: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+userId.String(), nil)
+			req.Header.Set("If-Modified-Since", test.ifModifiedSince)
+			req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+			rec := httptest.NewRecorder()
+
+			controller.FindById(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+			assert.Equal(t, "Sat, 01 Mar 2025 12:30:15 GMT", rec.Header().Get("Last-Modified"))
+			if test.expectedCode == http.StatusNotModified {
+				assert.Empty(t, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFindUserByIdTimeout(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	userId := uuid.New()
+
+	mockService.On("FindById", mock.Anything, userId).
+		Return(response.UserResponse{}, fmt.Errorf("failed to execute query: %w", context.DeadlineExceeded))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+userId.String(), nil)
+	rec := httptest.NewRecorder()
+
+	vars := map[string]string{"userId": userId.String()}
+	req = mux.SetURLVars(req, vars)
+
+	controller.FindById(rec, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestSearchUsers(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	page := response.UserPageResponse{
+		Users: []response.UserResponse{
+			{Id: uuid.New(), Name: "Elif", Surname: "Çelik", Snippet: "<mark>Çel</mark>ik"},
+		},
+		Pagination: response.Pagination{Total: 1, Limit: 5},
+	}
+	mockService.On("Search", mock.Anything, request.UserSearchRequest{Query: "cel", Limit: 5}).Return(page, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/search?q=cel&limit=5", nil)
+	rec := httptest.NewRecorder()
+
+	controller.Search(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"snippet":"\u003cmark\u003eÇel\u003c/mark\u003eik"`)
+	mockService.AssertExpectations(t)
+}
+
+func TestRestoreUser(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	userId := uuid.New()
+	mockService.On("Restore", mock.Anything, userId).Return(response.UserResponse{Id: userId, Name: "John"}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/user/%s/restore", userId), nil)
+	req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+	rec := httptest.NewRecorder()
+
+	controller.Restore(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), userId.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestRestoreUserNotDeleted(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	userId := uuid.New()
+	mockService.On("Restore", mock.Anything, userId).Return(response.UserResponse{}, helper.NewErrorResponse(http.StatusNotFound, "Deleted user not found", nil))
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/user/%s/restore", userId), nil)
+	req = mux.SetURLVars(req, map[string]string{"userId": userId.String()})
+	rec := httptest.NewRecorder()
+
+	controller.Restore(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestExportUsers(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected := request.UserExportRequest{
+		Format:      "ndjson",
+		Columns:     []string{"id", "email"},
+		EmailDomain: "example.com",
+		CreatedFrom: &from,
+	}
+	mockService.On("Export", mock.Anything, expected, mock.Anything).Run(func(args mock.Arguments) {
+		io.WriteString(args.Get(2).(io.Writer), `{"id":"1","email":"john@example.com"}`+"\n")
+	}).Return(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/export?format=ndjson&columns=id,email&email_domain=example.com&created_from=2025-01-01", nil)
+	rec := httptest.NewRecorder()
+
+	controller.Export(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	assert.True(t, rec.Flushed, "Expected rows to be flushed as they are written")
+	assert.Equal(t, `{"id":"1","email":"john@example.com"}`+"\n", rec.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestExportUsersFailsBeforeStreaming(t *testing.T) {
+	mockService := new(MockUserService)
+	controller := NewUserController(mockService)
+
+	mockService.On("Export", mock.Anything, request.UserExportRequest{Format: "csv", Columns: []string{"password"}}, mock.Anything).
+		Return(helper.NewErrorResponse(http.StatusBadRequest, "Invalid columns parameter", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/export?columns=password", nil)
+	rec := httptest.NewRecorder()
+
+	controller.Export(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+	mockService.AssertExpectations(t)
+}
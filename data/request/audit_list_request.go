@@ -0,0 +1,12 @@
+package request
+
+import "time"
+
+type AuditListRequest struct {
+	Limit  int        `json:"limit" validate:"min=0,max=100"`
+	Offset int        `json:"offset" validate:"min=0"`
+	UserId string     `json:"user_id" validate:"omitempty,uuid"`
+	Actor  string     `json:"actor" validate:"omitempty,max=200"`
+	From   *time.Time `json:"from"`
+	To     *time.Time `json:"to"`
+}
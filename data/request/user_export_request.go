@@ -0,0 +1,11 @@
+package request
+
+import "time"
+
+type UserExportRequest struct {
+	Format      string     `json:"format" validate:"omitempty,oneof=csv ndjson"`
+	Columns     []string   `json:"columns"`
+	EmailDomain string     `json:"email_domain" validate:"omitempty,fqdn"`
+	CreatedFrom *time.Time `json:"created_from"`
+	CreatedTo   *time.Time `json:"created_to"`
+}
@@ -0,0 +1,6 @@
+package request
+
+type UserImportRequest struct {
+	DryRun    bool `json:"dry_run"`
+	ChunkSize int  `json:"chunk_size" validate:"omitempty,min=1"`
+}
@@ -0,0 +1,19 @@
+package request
+
+import "time"
+
+type UserListRequest struct {
+	Limit       int        `json:"limit" validate:"min=0,max=100"`
+	Offset      int        `json:"offset" validate:"min=0"`
+	Cursor      string     `json:"cursor" validate:"excluded_with=Offset"`
+	Sort        string     `json:"sort"`
+	Name        string     `json:"name" validate:"omitempty,max=100"`
+	Surname     string     `json:"surname" validate:"omitempty,max=100"`
+	EmailDomain string     `json:"email_domain" validate:"omitempty,fqdn"`
+	CreatedFrom *time.Time `json:"created_from"`
+	CreatedTo   *time.Time `json:"created_to"`
+
+	UpdatedSince *time.Time `json:"updated_since"`
+
+	IncludeDeleted bool `json:"include_deleted"`
+}
@@ -0,0 +1,23 @@
+package request
+
+// UserPatchRequest carries a patch for a user as it was sent: a JSON merge
+// patch (RFC 7396) or a JSON patch (RFC 6902), told apart by ContentType.
+type UserPatchRequest struct {
+	ContentType string
+	Patch       []byte
+
+	// Version is the version the client last read, taken from If-Match.
+	// Zero skips the check.
+	Version int64
+}
+
+// UserPatchDocument is the part of a user a patch is applied to. The patched
+// document must pass the same validation as a new user. Every field of a user
+// is required, so a merge patch null or a JSON patch remove of one is always
+// rejected; patches can only change fields.
+type UserPatchDocument struct {
+	Name        string `json:"name" validate:"required,min=2,max=100"`
+	Surname     string `json:"surname" validate:"required,min=2,max=100"`
+	Email       string `json:"email" validate:"required,email"`
+	PhoneNumber string `json:"phone_number" validate:"required,min=10,max=15"`
+}
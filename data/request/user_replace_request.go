@@ -0,0 +1,23 @@
+package request
+
+// UserReplaceRequest holds every mutable field of a user, replacing the ones
+// it has or creating the user with them.
+type UserReplaceRequest struct {
+	Name        string `json:"name" validate:"required,min=2,max=100"`
+	Surname     string `json:"surname" validate:"required,min=2,max=100"`
+	Email       string `json:"email" validate:"required,email"`
+	PhoneNumber string `json:"phone_number" validate:"required,min=10,max=15"`
+
+	// Version is the version the client last read, taken from If-Match.
+	// Zero skips the check. A replace with a version never creates a user.
+	Version int64 `json:"-"`
+
+	// MustExist, from If-Match: *, replaces the user at whatever version it
+	// is but never creates it.
+	MustExist bool `json:"-"`
+
+	// RequireVersion rejects changing an existing user without a Version.
+	// Creating a user, or replacing it with what it already has, is still
+	// allowed.
+	RequireVersion bool `json:"-"`
+}
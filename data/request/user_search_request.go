@@ -0,0 +1,7 @@
+package request
+
+type UserSearchRequest struct {
+	Query  string `json:"q" validate:"required,max=200"`
+	Limit  int    `json:"limit" validate:"min=0,max=100"`
+	Offset int    `json:"offset" validate:"min=0"`
+}
@@ -3,9 +3,15 @@ package request
 import "github.com/google/uuid"
 
 type UserUpdateRequest struct {
-	Id          uuid.UUID `json:"id" validate:"required,uuid"`
-	Name        string    `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
-	Surname     string    `json:"surname,omitempty" validate:"omitempty,min=2,max=100"`
-	Email       string    `json:"email,omitempty" validate:"omitempty,email"`
-	PhoneNumber string    `json:"phone_number,omitempty" validate:"omitempty,min=10,max=15"`
+	// Id is still accepted from clients that send it, but the user is
+	// always the one in the path; a different id is rejected.
+	Id          *uuid.UUID `json:"id,omitempty"`
+	Name        string     `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
+	Surname     string     `json:"surname,omitempty" validate:"omitempty,min=2,max=100"`
+	Email       string     `json:"email,omitempty" validate:"omitempty,email"`
+	PhoneNumber string     `json:"phone_number,omitempty" validate:"omitempty,min=10,max=15"`
+
+	// Version is the version the client last read, taken from If-Match.
+	// Zero skips the check.
+	Version int64 `json:"-"`
 }
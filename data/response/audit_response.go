@@ -0,0 +1,28 @@
+package response
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FieldChange struct {
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+type AuditResponse struct {
+	Id        int64                  `json:"id"`
+	Actor     string                 `json:"actor"`
+	Action    string                 `json:"action"`
+	UserId    uuid.UUID              `json:"user_id"`
+	Changes   map[string]FieldChange `json:"changes"`
+	RequestId string                 `json:"request_id,omitempty"`
+	ClientIP  string                 `json:"client_ip,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type AuditPageResponse struct {
+	Entries    []AuditResponse
+	Pagination Pagination
+}
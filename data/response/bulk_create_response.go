@@ -0,0 +1,19 @@
+package response
+
+import "github.com/google/uuid"
+
+// BulkCreateResult is the outcome of creating one user of a bulk request.
+// Status is the HTTP status the user would have been created or rejected
+// with on its own, and Error holds the matching error response.
+type BulkCreateResult struct {
+	Index  int        `json:"index"`
+	Status int        `json:"status"`
+	Id     *uuid.UUID `json:"id,omitempty"`
+	Error  error      `json:"error,omitempty"`
+}
+
+type BulkCreateResponse struct {
+	Results []BulkCreateResult `json:"results"`
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+}
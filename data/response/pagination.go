@@ -0,0 +1,14 @@
+package response
+
+type Pagination struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+type UserPageResponse struct {
+	Users      []UserResponse
+	Pagination Pagination
+}
@@ -0,0 +1,25 @@
+package response
+
+import "github.com/google/uuid"
+
+// ImportRowResult is the outcome of importing one CSV row. Line is the line
+// the row starts on, counting the header as line 1.
+type ImportRowResult struct {
+	Line   int        `json:"line"`
+	Status int        `json:"status"`
+	Id     *uuid.UUID `json:"id,omitempty"`
+	Error  error      `json:"error,omitempty"`
+}
+
+// UserImportResponse reports every row of an import that was read. In a dry
+// run Created counts the users that would have been created. StoppedAtLine is
+// set when reading stopped at a malformed row; the rows after it were not
+// read and are not reported or counted.
+type UserImportResponse struct {
+	DryRun         bool              `json:"dry_run"`
+	Rows           []ImportRowResult `json:"rows"`
+	Created        int               `json:"created"`
+	Failed         int               `json:"failed"`
+	StoppedAtLine  int               `json:"stopped_at_line,omitempty"`
+	IgnoredColumns []string          `json:"ignored_columns,omitempty"`
+}
@@ -12,4 +12,8 @@ type UserResponse struct {
 	Email       string    `json:"email"`        
 	PhoneNumber string    `json:"phone_number"` 
 	CreatedAt   time.Time `json:"created_at"`   
+	UpdatedAt   time.Time `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Version     int64     `json:"version"`
+	Snippet     string    `json:"snippet,omitempty"`
 }
\ No newline at end of file
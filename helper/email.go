@@ -0,0 +1,51 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrInvalidEmail = errors.New("invalid email")
+
+// EmailRules are the provider-specific rules CanonicalEmail applies. They are
+// off by default because they merge addresses that other providers deliver
+// to different mailboxes.
+type EmailRules struct {
+	// GmailDots ignores dots in the local part of Gmail addresses and treats
+	// googlemail.com as gmail.com.
+	GmailDots bool
+	// PlusTags ignores everything from the first + in the local part.
+	PlusTags bool
+}
+
+// CanonicalEmail returns the form under which two addresses of the same
+// mailbox are equal: the local part is lowercased, the domain is converted to
+// lowercase punycode (IDNA), and then rules are applied.
+func CanonicalEmail(email string, rules EmailRules) (string, error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", fmt.Errorf("%w: %q has no local part or domain", ErrInvalidEmail, email)
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(email[at+1:], "."))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidEmail, email, err)
+	}
+	local := norm.NFC.String(strings.ToLower(email[:at]))
+
+	if rules.PlusTags {
+		if plus := strings.IndexByte(local, '+'); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if rules.GmailDots && (domain == "gmail.com" || domain == "googlemail.com") {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain, nil
+}
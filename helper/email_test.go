@@ -0,0 +1,41 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		rules    EmailRules
+		expected string
+	}{
+		{"john@example.com", EmailRules{}, "john@example.com"},
+		{"John@Example.COM", EmailRules{}, "john@example.com"},
+		{"john@example.com.", EmailRules{}, "john@example.com"},
+		{"Jöhn@Bücher.DE", EmailRules{}, "jöhn@xn--bcher-kva.de"},
+		{"john@xn--bcher-kva.de", EmailRules{}, "john@xn--bcher-kva.de"},
+		{"j.o.h.n+news@gmail.com", EmailRules{}, "j.o.h.n+news@gmail.com"},
+		{"j.o.h.n+news@gmail.com", EmailRules{GmailDots: true}, "john+news@gmail.com"},
+		{"J.Doe@GoogleMail.com", EmailRules{GmailDots: true}, "jdoe@gmail.com"},
+		{"j.doe@example.com", EmailRules{GmailDots: true}, "j.doe@example.com"},
+		{"john+news@example.com", EmailRules{PlusTags: true}, "john@example.com"},
+		{"+news@example.com", EmailRules{PlusTags: true}, "+news@example.com"},
+		{"j.o.h.n+news@gmail.com", EmailRules{GmailDots: true, PlusTags: true}, "john@gmail.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			canonical, err := CanonicalEmail(tt.email, tt.rules)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, canonical)
+		})
+	}
+
+	for _, email := range []string{"john", "@example.com", "john@", "john@ex_ample.com"} {
+		_, err := CanonicalEmail(email, EmailRules{})
+		assert.ErrorIs(t, err, ErrInvalidEmail, email)
+	}
+}
@@ -1,9 +1,11 @@
 package helper
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -32,6 +34,33 @@ func NewErrorResponse(code int, message string, validationErrors []ValidationErr
 	}
 }
 
+// StatusClientClosedRequest is the non-standard status used when the client
+// went away before the request finished.
+const StatusClientClosedRequest = 499
+
+// FromContextError returns a 504 response when err was caused by the request
+// deadline, a 499 response when the client cancelled the request, and nil
+// otherwise.
+func FromContextError(err error) *ErrorResponse {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewErrorResponse(http.StatusGatewayTimeout, "Request timed out", nil)
+	case errors.Is(err, context.Canceled):
+		return NewErrorResponse(StatusClientClosedRequest, "Client closed request", nil)
+	default:
+		return nil
+	}
+}
+
+// NewInternalErrorResponse wraps an unexpected error from a lower layer. It
+// keeps cancellations distinguishable from real failures.
+func NewInternalErrorResponse(err error, message string) *ErrorResponse {
+	if errorResponse := FromContextError(err); errorResponse != nil {
+		return errorResponse
+	}
+	return NewErrorResponse(http.StatusInternalServerError, message, nil)
+}
+
 func FormatValidationError(err error) *ErrorResponse {
 	var ve validator.ValidationErrors
 	if errors.As(err, &ve) {
@@ -5,10 +5,9 @@ import (
 	"os"
 )
 
-func EnsureDBDirectory() {
-	const dbDir = "db"
+func EnsureDBDirectory(dbDir string) {
 	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
-		err := os.Mkdir(dbDir, os.ModePerm)
+		err := os.MkdirAll(dbDir, os.ModePerm)
 		if err != nil {
 			log.Fatalf("Failed to create directory %s: %v", dbDir, err)
 		}
@@ -3,6 +3,7 @@ package helper
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -11,7 +12,7 @@ func ReadRequestBody(r *http.Request, result interface{}) error {
 	decoder.DisallowUnknownFields() 
 	err := decoder.Decode(result)
 	if err != nil {
-		return errors.New("invalid JSON format or unexpected fields")
+		return fmt.Errorf("invalid JSON format or unexpected fields: %w", err)
 	}
 	return nil
 }
@@ -34,3 +35,13 @@ func WriteJSONResponse(w http.ResponseWriter, statusCode int, payload interface{
 	json.NewEncoder(w).Encode(payload)
 }
 
+// WriteErrorResponse writes err as JSON. An *ErrorResponse keeps its own code,
+// context cancellations become 504/499 and anything else becomes a 500.
+func WriteErrorResponse(w http.ResponseWriter, err error) {
+	var errorResponse *ErrorResponse
+	if !errors.As(err, &errorResponse) {
+		errorResponse = NewInternalErrorResponse(err, "Internal server error")
+	}
+	WriteJSONResponse(w, errorResponse.Code, errorResponse)
+}
+
@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const patchDocument = `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara","zip":"06100"}}`
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+	}{
+		{"replace member", `{"name":"Jane"}`, `{"name":"Jane","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara","zip":"06100"}}`},
+		{"null removes member", `{"email":null}`, `{"name":"John","surname":"Doe","tags":["a","b"],"address":{"city":"Ankara","zip":"06100"}}`},
+		{"nested object is merged", `{"address":{"zip":null,"street":"Atatürk"}}`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara","street":"Atatürk"}}`},
+		{"array is replaced", `{"tags":["c"]}`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["c"],"address":{"city":"Ankara","zip":"06100"}}`},
+		{"non-object replaces document", `"John"`, `"John"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := ApplyMergePatch([]byte(patchDocument), []byte(tt.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(patched))
+		})
+	}
+
+	_, err := ApplyMergePatch([]byte(patchDocument), []byte(`{"name":`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+	}{
+		{"replace", `[{"op":"replace","path":"/name","value":"Jane"}]`, `{"name":"Jane","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara","zip":"06100"}}`},
+		{"remove", `[{"op":"remove","path":"/address/zip"}]`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara"}}`},
+		{"add to array", `[{"op":"add","path":"/tags/1","value":"x"},{"op":"add","path":"/tags/-","value":"y"}]`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","x","b","y"],"address":{"city":"Ankara","zip":"06100"}}`},
+		{"move", `[{"op":"move","from":"/address/city","path":"/city"}]`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"zip":"06100"},"city":"Ankara"}`},
+		{"copy is independent", `[{"op":"copy","from":"/address","path":"/home"},{"op":"remove","path":"/home/zip"}]`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara","zip":"06100"},"home":{"city":"Ankara"}}`},
+		{"test then replace", `[{"op":"test","path":"/tags","value":["a","b"]},{"op":"replace","path":"/tags/0","value":"z"}]`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["z","b"],"address":{"city":"Ankara","zip":"06100"}}`},
+		{"escaped pointer", `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"name":"John","surname":"Doe","email":"john.doe@example.com","tags":["a","b"],"address":{"city":"Ankara","zip":"06100"},"a/b~c":1}`},
+		{"empty patch", `[]`, patchDocument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := ApplyJSONPatch([]byte(patchDocument), []byte(tt.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(patched))
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		err   error
+	}{
+		{"test fails", `[{"op":"test","path":"/name","value":"Jane"},{"op":"remove","path":"/name"}]`, ErrPatchTestFailed},
+		{"not an array", `{"op":"remove","path":"/name"}`, ErrInvalidPatch},
+		{"unknown op", `[{"op":"delete","path":"/name"}]`, ErrInvalidPatch},
+		{"missing value", `[{"op":"replace","path":"/name"}]`, ErrInvalidPatch},
+		{"replace missing member", `[{"op":"replace","path":"/phone_number","value":"5550000001"}]`, ErrInvalidPatch},
+		{"remove missing member", `[{"op":"remove","path":"/phone_number"}]`, ErrInvalidPatch},
+		{"relative pointer", `[{"op":"remove","path":"name"}]`, ErrInvalidPatch},
+		{"index out of range", `[{"op":"add","path":"/tags/3","value":"c"}]`, ErrInvalidPatch},
+		{"leading zero index", `[{"op":"remove","path":"/tags/01"}]`, ErrInvalidPatch},
+		{"move into itself", `[{"op":"move","from":"/address","path":"/address/home"}]`, ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyJSONPatch([]byte(patchDocument), []byte(tt.patch))
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
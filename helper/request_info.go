@@ -0,0 +1,25 @@
+package helper
+
+import "context"
+
+// RequestInfo describes who made a request and where it came from. It is
+// carried on the request context so that the repository can attribute audit
+// log entries.
+type RequestInfo struct {
+	Actor     string
+	RequestId string
+	ClientIP  string
+}
+
+type requestInfoKey struct{}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the RequestInfo attached to ctx, or the zero value
+// when there is none.
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
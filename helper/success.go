@@ -1,9 +1,12 @@
 package helper
 
+import "user-crud/data/response"
+
 type SuccessResponse struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Code       int                  `json:"code"`
+	Message    string               `json:"message"`
+	Data       interface{}          `json:"data,omitempty"`
+	Pagination *response.Pagination `json:"pagination,omitempty"`
 }
 
 func NewSuccessResponse(code int, message string, data interface{}) *SuccessResponse {
@@ -13,3 +16,12 @@ func NewSuccessResponse(code int, message string, data interface{}) *SuccessResp
 		Data:    data,
 	}
 }
+
+func NewPagedSuccessResponse(code int, message string, data interface{}, pagination response.Pagination) *SuccessResponse {
+	return &SuccessResponse{
+		Code:       code,
+		Message:    message,
+		Data:       data,
+		Pagination: &pagination,
+	}
+}
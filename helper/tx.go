@@ -1,17 +1,40 @@
 package helper
 
-import "database/sql"
-
-func CommitOrRollback(tx *sql.Tx) {
-	err := recover()
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
 
+// WithTx runs fn inside a transaction. The transaction is rolled back when fn
+// returns an error or panics, and committed otherwise. A panic is logged and
+// returned as an error so that one failing request cannot stop the process.
+func WithTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
 	if err != nil {
-		errRollBack := tx.Rollback()
-		HandleError(errRollBack, "Failed to rollback transaction")
-		panic(err)
-	} else {
-		errCommit := tx.Commit()
-		HandleError(errCommit, "Failed to commit transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-}
\ No newline at end of file
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Transaction panicked: %v\n%s", recovered, debug.Stack())
+			err = fmt.Errorf("transaction panicked: %v", recovered)
+		}
+
+		if err != nil {
+			if errRollback := tx.Rollback(); errRollback != nil && !errors.Is(errRollback, sql.ErrTxDone) {
+				err = errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", errRollback))
+			}
+			return
+		}
+
+		if errCommit := tx.Commit(); errCommit != nil {
+			err = fmt.Errorf("failed to commit transaction: %w", errCommit)
+		}
+	}()
+
+	return fn(tx)
+}
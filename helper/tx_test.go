@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database connection: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, mock
+}
+
+func TestWithTxCommitsOnSuccess(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err := WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	failure := errors.New("insert failed")
+	err := WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+		return failure
+	})
+
+	assert.ErrorIs(t, err, failure)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+		panic("boom")
+	})
+
+	assert.ErrorContains(t, err, "boom")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxReportsCommitFailure(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("disk I/O error"))
+
+	err := WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+		return nil
+	})
+
+	assert.ErrorContains(t, err, "failed to commit transaction")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -21,7 +21,8 @@ func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 			if allowed {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-Actor, X-Request-Id")
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-Id")
 
 				// OPTIONS isteğini ele al
 				if r.Method == http.MethodOptions {
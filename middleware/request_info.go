@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+	"user-crud/helper"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ActorHeader     = "X-Actor"
+	RequestIdHeader = "X-Request-Id"
+
+	// AnonymousActor is recorded for requests that do not identify their
+	// actor.
+	AnonymousActor = "anonymous"
+
+	maxHeaderValueLength = 200
+)
+
+// RequestInfoMiddleware attaches a helper.RequestInfo to the request context.
+// An actor already set by an earlier middleware, such as authentication, is
+// kept. Otherwise it is taken from the X-Actor header if trustActorHeader is
+// set, which is only safe behind a proxy that sets the header itself, since
+// any client can send it. The request id is taken from X-Request-Id or
+// generated, and echoed in the response.
+func RequestInfoMiddleware(trustActorHeader bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := helper.RequestInfoFrom(r.Context())
+
+			if info.Actor == "" && trustActorHeader {
+				info.Actor = headerValue(r, ActorHeader)
+			}
+			if info.Actor == "" {
+				info.Actor = AnonymousActor
+			}
+
+			info.RequestId = headerValue(r, RequestIdHeader)
+			if info.RequestId == "" {
+				info.RequestId = uuid.NewString()
+			}
+
+			info.ClientIP = r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				info.ClientIP = host
+			}
+
+			w.Header().Set(RequestIdHeader, info.RequestId)
+			next.ServeHTTP(w, r.WithContext(helper.WithRequestInfo(r.Context(), info)))
+		})
+	}
+}
+
+func headerValue(r *http.Request, name string) string {
+	value := strings.TrimSpace(r.Header.Get(name))
+	if len(value) > maxHeaderValueLength {
+		// Cut before the character that crosses the limit, so the value
+		// stays valid UTF-8.
+		end := maxHeaderValueLength
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		value = value[:end]
+	}
+	return value
+}
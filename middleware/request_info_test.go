@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"user-crud/helper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestInfoMiddleware(t *testing.T) {
+	var info helper.RequestInfo
+	handler := RequestInfoMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = helper.RequestInfoFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/user/1", nil)
+	req.RemoteAddr = "192.0.2.1:54321"
+	req.Header.Set(ActorHeader, "alice")
+	req.Header.Set(RequestIdHeader, "req-1")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, helper.RequestInfo{Actor: "alice", RequestId: "req-1", ClientIP: "192.0.2.1"}, info)
+	assert.Equal(t, "req-1", rec.Header().Get(RequestIdHeader))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/user/1", nil))
+
+	assert.Equal(t, AnonymousActor, info.Actor)
+	assert.NotEmpty(t, info.RequestId, "Expected a request id to be generated")
+	assert.Equal(t, info.RequestId, rec.Header().Get(RequestIdHeader))
+}
+
+func TestRequestInfoMiddlewareIgnoresUntrustedActorHeader(t *testing.T) {
+	var info helper.RequestInfo
+	handler := RequestInfoMiddleware(false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = helper.RequestInfoFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user", nil)
+	req.Header.Set(ActorHeader, "mallory")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, AnonymousActor, info.Actor)
+}
+
+func TestRequestInfoMiddlewareKeepsAuthenticatedActor(t *testing.T) {
+	var info helper.RequestInfo
+	handler := RequestInfoMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = helper.RequestInfoFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user", nil)
+	req.Header.Set(ActorHeader, "mallory")
+	req = req.WithContext(helper.WithRequestInfo(context.Background(), helper.RequestInfo{Actor: "alice"}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "alice", info.Actor)
+}
+
+func TestRequestInfoMiddlewareTruncatesAtCharacterBoundary(t *testing.T) {
+	var info helper.RequestInfo
+	handler := RequestInfoMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = helper.RequestInfoFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user", nil)
+	req.Header.Set(ActorHeader, "a"+strings.Repeat("é", 150))
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, utf8.ValidString(info.Actor), "Expected valid UTF-8, got %q", info.Actor)
+	assert.Equal(t, "a"+strings.Repeat("é", 99), info.Actor)
+}
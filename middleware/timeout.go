@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteTimeouts holds the request deadline for each named route and the
+// deadline used for routes without an entry.
+type RouteTimeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+func (timeouts RouteTimeouts) For(route string) time.Duration {
+	if timeout, ok := timeouts.Routes[route]; ok {
+		return timeout
+	}
+	return timeouts.Default
+}
+
+// TimeoutMiddleware attaches a deadline to the request context based on the
+// name of the matched mux route, so that database calls made with that
+// context are cancelled once it expires.
+func TimeoutMiddleware(timeouts RouteTimeouts) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				name = route.GetName()
+			}
+
+			timeout := timeouts.For(name)
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
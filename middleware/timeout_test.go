@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutMiddlewareUsesRouteTimeout(t *testing.T) {
+	timeouts := RouteTimeouts{
+		Default: time.Second,
+		Routes:  map[string]time.Duration{"slow": time.Minute},
+	}
+
+	remaining := map[string]time.Duration{}
+	record := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok := r.Context().Deadline()
+			assert.True(t, ok, "Expected a deadline on the request context")
+			remaining[name] = time.Until(deadline)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.Use(TimeoutMiddleware(timeouts))
+	router.HandleFunc("/slow", record("slow")).Name("slow")
+	router.HandleFunc("/fast", record("fast")).Name("fast")
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+
+	assert.Greater(t, remaining["slow"], 30*time.Second)
+	assert.LessOrEqual(t, remaining["fast"], time.Second)
+}
@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+func init() {
+	register(2, "create_users_search", usersSearchFTS4+usersSearchFTS5+usersSearchTriggers+dropUsersSearchSQL, createUsersSearch, dropUsersSearch)
+	registerRecheck(2, upgradeUsersSearch)
+}
+
+const (
+	usersSearchFTS4 = `CREATE VIRTUAL TABLE users_search USING fts4(id, name, surname, email, notindexed=id, tokenize=unicode61 "remove_diacritics=2")`
+	usersSearchFTS5 = `CREATE VIRTUAL TABLE users_search USING fts5(id UNINDEXED, name, surname, email, tokenize="unicode61 remove_diacritics 2")`
+)
+
+// usersSearchTriggers keep users_search in step with users. Search rows share
+// the rowid of the user they index.
+const usersSearchTriggers = `
+CREATE TRIGGER users_search_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_search (rowid, id, name, surname, email) VALUES (new.rowid, new.id, new.name, new.surname, new.email);
+END;
+CREATE TRIGGER users_search_update AFTER UPDATE OF id, name, surname, email ON users BEGIN
+    UPDATE users_search SET id = new.id, name = new.name, surname = new.surname, email = new.email WHERE rowid = old.rowid;
+END;
+CREATE TRIGGER users_search_delete AFTER DELETE ON users BEGIN
+    DELETE FROM users_search WHERE rowid = old.rowid;
+END;
+INSERT INTO users_search (rowid, id, name, surname, email) SELECT rowid, id, name, surname, email FROM users;`
+
+// createUsersSearch creates the users_search full-text index. FTS5 is only
+// compiled into go-sqlite3 with the sqlite_fts5 build tag, so builds without
+// it fall back to FTS4, which matches the same queries but cannot rank them.
+func createUsersSearch(ctx context.Context, tx *sql.Tx, _ Options) error {
+	fts5, err := fts5Available(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	table := usersSearchFTS4
+	if fts5 {
+		table = usersSearchFTS5
+	}
+
+	if _, err := tx.ExecContext(ctx, table); err != nil {
+		return fmt.Errorf("failed to create users_search: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, usersSearchTriggers); err != nil {
+		return fmt.Errorf("failed to populate users_search: %w", err)
+	}
+
+	return nil
+}
+
+// upgradeUsersSearch rebuilds an FTS4 users_search with FTS5 once the binary
+// is built with the sqlite_fts5 tag, since the index is only created once. An
+// FTS5 index cannot be read without FTS5, so such builds are refused.
+func upgradeUsersSearch(ctx context.Context, tx *sql.Tx, options Options) error {
+	fts5, err := fts5Available(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var definition string
+	err = tx.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'users_search'").Scan(&definition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read users_search: %w", err)
+	}
+
+	indexed := strings.Contains(strings.ToLower(definition), "fts5")
+	switch {
+	case indexed && !fts5:
+		return errors.New("users_search uses FTS5, which this binary was built without; build it with -tags sqlite_fts5")
+	case indexed || !fts5:
+		return nil
+	}
+
+	if err := dropUsersSearch(ctx, tx, options); err != nil {
+		return fmt.Errorf("failed to drop users_search: %w", err)
+	}
+	if err := createUsersSearch(ctx, tx, options); err != nil {
+		return err
+	}
+
+	log.Printf("Rebuilt users_search with FTS5")
+	return nil
+}
+
+func fts5Available(ctx context.Context, tx *sql.Tx) (bool, error) {
+	var fts5 bool
+	if err := tx.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5 support: %w", err)
+	}
+	return fts5, nil
+}
+
+const dropUsersSearchSQL = `
+DROP TRIGGER IF EXISTS users_search_insert;
+DROP TRIGGER IF EXISTS users_search_update;
+DROP TRIGGER IF EXISTS users_search_delete;
+DROP TABLE IF EXISTS users_search;`
+
+func dropUsersSearch(ctx context.Context, tx *sql.Tx, _ Options) error {
+	_, err := tx.ExecContext(ctx, dropUsersSearchSQL)
+	return err
+}
@@ -0,0 +1,223 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"user-crud/helper"
+)
+
+func init() {
+	register(7, "add_users_email_canonical", canonicalEmailRevision+addUsersEmailCanonicalSQL+dropUsersEmailCanonicalSQL, addUsersEmailCanonical, dropUsersEmailCanonical)
+}
+
+// canonicalEmailRevision is bumped whenever canonicalizeEmails changes what
+// it backfills.
+const canonicalEmailRevision = "2"
+
+const (
+	addUsersEmailCanonicalSQL = `
+DROP INDEX users_email_active;
+CREATE UNIQUE INDEX users_email_canonical_active ON users (email_canonical) WHERE deleted_at IS NULL;`
+	dropUsersEmailCanonicalSQL = `
+DROP INDEX users_email_canonical_active;
+CREATE UNIQUE INDEX users_email_active ON users (email) WHERE deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN email_canonical;`
+)
+
+// EmailCollision is a canonical email that more than one active user would
+// have, with those users' ids and emails as they were typed.
+type EmailCollision struct {
+	CanonicalEmail string
+	UserIds        []string
+	Emails         []string
+}
+
+// EmailCollisionError is returned when canonical emails cannot be made
+// unique because active users would share them.
+type EmailCollisionError struct {
+	Collisions []EmailCollision
+}
+
+func (e *EmailCollisionError) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d canonical email(s) would be shared by active users; change or delete all but one user of each and try again:", len(e.Collisions))
+	for _, collision := range e.Collisions {
+		fmt.Fprintf(&builder, "\n  %s:", collision.CanonicalEmail)
+		for i, userId := range collision.UserIds {
+			separator := ","
+			if i == 0 {
+				separator = ""
+			}
+			fmt.Fprintf(&builder, "%s %s (%s)", separator, userId, collision.Emails[i])
+		}
+	}
+	return builder.String()
+}
+
+// InvalidEmail is an email, saved before emails were canonicalized, that has
+// no canonical form, with the reason it was rejected.
+type InvalidEmail struct {
+	UserId  string
+	Email   string
+	Deleted bool
+	Reason  string
+}
+
+// InvalidEmailError is returned when canonical emails cannot be set because
+// some users' emails have none.
+type InvalidEmailError struct {
+	Emails []InvalidEmail
+}
+
+func (e *InvalidEmailError) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d email(s) have no canonical form; change them, or purge the deleted users, and try again:", len(e.Emails))
+	for _, email := range e.Emails {
+		deleted := ""
+		if email.Deleted {
+			deleted = ", deleted"
+		}
+		fmt.Fprintf(&builder, "\n  %s (%s%s): %s", email.UserId, email.Email, deleted, email.Reason)
+	}
+	return builder.String()
+}
+
+// addUsersEmailCanonical makes emails unique by their canonical form instead
+// of as they were typed. It fails with an *InvalidEmailError or an
+// *EmailCollisionError, and changes nothing, when existing emails have no
+// canonical form or users would share one.
+func addUsersEmailCanonical(ctx context.Context, tx *sql.Tx, options Options) error {
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE users ADD COLUMN email_canonical TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("failed to add email_canonical: %w", err)
+	}
+
+	if _, err := canonicalizeEmails(ctx, tx, options.EmailRules); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, addUsersEmailCanonicalSQL)
+	return err
+}
+
+func dropUsersEmailCanonical(ctx context.Context, tx *sql.Tx, _ Options) error {
+	_, err := tx.ExecContext(ctx, dropUsersEmailCanonicalSQL)
+	return err
+}
+
+// CanonicalizeEmails sets the canonical email of every user again with
+// Options.EmailRules, as is needed after the rules changed, and returns how
+// many changed. Like the migration that added them, it fails with an
+// *InvalidEmailError or an *EmailCollisionError.
+func (m *Migrator) CanonicalizeEmails(ctx context.Context) (int, error) {
+	var changed int
+
+	err := m.withLock(ctx, func() error {
+		records, err := m.verify(ctx)
+		if err != nil {
+			return err
+		}
+		if _, ok := records[7]; !ok {
+			return fmt.Errorf("migration 0007_add_users_email_canonical has to be applied first")
+		}
+
+		return m.apply(ctx, func(ctx context.Context, tx *sql.Tx, options Options) error {
+			changed, err = canonicalizeEmails(ctx, tx, options.EmailRules)
+			return err
+		}, func(tx *sql.Tx) error { return nil })
+	})
+
+	return changed, err
+}
+
+type canonicalEmail struct {
+	userId    string
+	email     string
+	canonical string
+	active    bool
+	changed   bool
+}
+
+func canonicalizeEmails(ctx context.Context, tx *sql.Tx, rules helper.EmailRules) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, email, email_canonical, deleted_at IS NULL FROM users ORDER BY created_at, id")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read emails: %w", err)
+	}
+	defer rows.Close()
+
+	var users []canonicalEmail
+	var invalid []InvalidEmail
+	owners := map[string][]int{}
+	for rows.Next() {
+		var user canonicalEmail
+		var current string
+		if err := rows.Scan(&user.userId, &user.email, &current, &user.active); err != nil {
+			return 0, fmt.Errorf("failed to read email: %w", err)
+		}
+
+		user.canonical, err = helper.CanonicalEmail(user.email, rules)
+		if err != nil {
+			// Emails saved before they were canonicalized may fail the
+			// IDNA checks. Guessing a canonical form for them could let a
+			// duplicate in, so they have to be fixed first.
+			invalid = append(invalid, InvalidEmail{UserId: user.userId, Email: user.email, Deleted: !user.active, Reason: err.Error()})
+			continue
+		}
+		user.changed = user.canonical != current
+
+		if user.active {
+			owners[user.canonical] = append(owners[user.canonical], len(users))
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read emails: %w", err)
+	}
+	rows.Close()
+
+	if len(invalid) > 0 {
+		return 0, &InvalidEmailError{Emails: invalid}
+	}
+
+	var collisions []EmailCollision
+	for canonical, indexes := range owners {
+		if len(indexes) < 2 {
+			continue
+		}
+		collision := EmailCollision{CanonicalEmail: canonical}
+		for _, i := range indexes {
+			collision.UserIds = append(collision.UserIds, users[i].userId)
+			collision.Emails = append(collision.Emails, users[i].email)
+		}
+		collisions = append(collisions, collision)
+	}
+	if len(collisions) > 0 {
+		sort.Slice(collisions, func(i, j int) bool { return collisions[i].CanonicalEmail < collisions[j].CanonicalEmail })
+		return 0, &EmailCollisionError{Collisions: collisions}
+	}
+
+	// Changed users first get their id, which is no one's canonical email,
+	// so that two users swapping canonical emails never share one midway.
+	changed := 0
+	for _, user := range users {
+		if !user.changed {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email_canonical = id WHERE id = ?", user.userId); err != nil {
+			return 0, fmt.Errorf("failed to update canonical email: %w", err)
+		}
+		changed++
+	}
+	for _, user := range users {
+		if !user.changed {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email_canonical = ? WHERE id = ?", user.canonical, user.userId); err != nil {
+			return 0, fmt.Errorf("failed to update canonical email: %w", err)
+		}
+	}
+
+	return changed, nil
+}
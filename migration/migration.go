@@ -0,0 +1,564 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"user-crud/helper"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+var (
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrUnknownMigration = errors.New("database has a migration that is not known to this build")
+	ErrLocked           = errors.New("migration lock is held by another process")
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is either a pair of SQL scripts or, for changes that depend on
+// the database or need Go code, a pair of functions registered with register.
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	UpFunc   MigrationFunc
+	DownFunc MigrationFunc
+	Checksum string
+
+	// recheck, if set, runs on every Up once the migration is applied, for
+	// migrations whose outcome depends on the build, not just the schema.
+	recheck MigrationFunc
+
+	// legacyChecksum is what Go migrations were recorded with before their
+	// source was checksummed. A record with it is upgraded to Checksum.
+	legacyChecksum string
+}
+
+type MigrationFunc func(ctx context.Context, tx *sql.Tx, options Options) error
+
+// Options are passed to the Go migrations whose outcome depends on how the
+// application is configured.
+type Options struct {
+	// EmailRules decide the canonical emails users are backfilled with.
+	EmailRules helper.EmailRules
+}
+
+// goMigrations holds the Go migrations of this package.
+var goMigrations []Migration
+
+// register adds a Go migration. source is checksummed in place of a script,
+// so it has to change whenever what the migration does changes: the SQL it
+// runs, and a revision to bump for changes in Go code.
+func register(version int64, name, source string, up, down MigrationFunc) {
+	goMigrations = append(goMigrations, Migration{
+		Version:        version,
+		Name:           name,
+		UpFunc:         up,
+		DownFunc:       down,
+		Checksum:       checksum("go:"+name, source),
+		legacyChecksum: checksum("go:"+name, ""),
+	})
+}
+
+// registerRecheck makes Up run recheck for the Go migration version on every
+// start after it was applied. recheck is not part of the checksum.
+func registerRecheck(version int64, recheck MigrationFunc) {
+	for i := range goMigrations {
+		if goMigrations[i].Version == version {
+			goMigrations[i].recheck = recheck
+			return
+		}
+	}
+	panic(fmt.Sprintf("migration %d is not registered", version))
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool
+	Unknown   bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+
+	LockTimeout    time.Duration
+	StaleLockAfter time.Duration
+	Owner          string
+	Options        Options
+}
+
+// New returns a Migrator for the migrations embedded in this binary and the
+// Go migrations registered in this package.
+func New(db *sql.DB) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewFromFS(db, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[int64]bool{}
+	for _, migration := range migrator.migrations {
+		versions[migration.Version] = true
+	}
+	for _, migration := range goMigrations {
+		if versions[migration.Version] {
+			return nil, fmt.Errorf("migration version %d is defined both in SQL and in Go", migration.Version)
+		}
+		versions[migration.Version] = true
+		migrator.migrations = append(migrator.migrations, migration)
+	}
+
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// NewFromFS returns a Migrator for the NNNN_name.up.sql / NNNN_name.down.sql
+// files at the root of fsys.
+func NewFromFS(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &Migrator{
+		db:             db,
+		migrations:     migrations,
+		LockTimeout:    30 * time.Second,
+		StaleLockAfter: 10 * time.Minute,
+		Owner:          fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.UpSQL = string(content)
+		} else {
+			migration.DownSQL = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.UpSQL) == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", migration.Version, migration.Name)
+		}
+		migration.Checksum = checksum(migration.UpSQL, migration.DownSQL)
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func checksum(up, down string) string {
+	hash := sha256.New()
+	hash.Write([]byte(up))
+	hash.Write([]byte{0})
+	hash.Write([]byte(down))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(ctx, func() error {
+		records, err := m.verify(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := records[migration.Version]; ok {
+				continue
+			}
+
+			err := m.apply(ctx, migration.up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+					migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+			applied = append(applied, migration)
+		}
+
+		for _, migration := range m.migrations {
+			if migration.recheck == nil {
+				continue
+			}
+
+			err := m.apply(ctx, migration.recheck, func(*sql.Tx) error { return nil })
+			if err != nil {
+				return fmt.Errorf("failed to recheck migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(ctx, func() error {
+		records, err := m.verify(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+
+			if strings.TrimSpace(migration.DownSQL) == "" && migration.DownFunc == nil {
+				return fmt.Errorf("migration %04d_%s has no down script", migration.Version, migration.Name)
+			}
+
+			err := m.apply(ctx, migration.down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to revert migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Printf("Reverted migration %04d_%s", migration.Version, migration.Name)
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status reports every known migration and every applied migration that
+// this build does not know about. It does not write to the database.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	records := map[int64]record{}
+
+	var name string
+	err := m.db.QueryRowContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed to check for schema_migrations: %w", err)
+	default:
+		records, err = m.records(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := records[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.appliedAt
+			status.Modified = record.checksum != migration.Checksum && !migration.isLegacy(record.checksum)
+			delete(records, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range records {
+		statuses = append(statuses, Status{
+			Version:   record.version,
+			Name:      record.name,
+			Applied:   true,
+			AppliedAt: record.appliedAt,
+			Unknown:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Pending returns the number of known migrations that have not been applied.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+type record struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    owner TEXT NOT NULL,
+    acquired_at DATETIME NOT NULL
+);`)
+	if err != nil {
+		return fmt.Errorf("failed to create migration tables: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) records(ctx context.Context) (map[int64]record, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	records := map[int64]record{}
+	for rows.Next() {
+		var r record
+		if err := rows.Scan(&r.version, &r.name, &r.checksum, &r.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		records[r.version] = r
+	}
+
+	return records, rows.Err()
+}
+
+// isLegacy reports whether checksum is the one migration was recorded with
+// before Go migrations had their source checksummed.
+func (migration Migration) isLegacy(checksum string) bool {
+	return migration.legacyChecksum != "" && checksum == migration.legacyChecksum && checksum != migration.Checksum
+}
+
+// verify refuses to run when an applied migration was edited after it was
+// applied or when the database is ahead of this build. Go migrations recorded
+// with their legacy checksum are trusted once and recorded with the current
+// one.
+func (m *Migrator) verify(ctx context.Context) (map[int64]record, error) {
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, record := range records {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %04d_%s", ErrUnknownMigration, version, record.name)
+		}
+		if migration.isLegacy(record.checksum) {
+			_, err := m.db.ExecContext(ctx, "UPDATE schema_migrations SET checksum = ? WHERE version = ?", migration.Checksum, version)
+			if err != nil {
+				return nil, fmt.Errorf("failed to upgrade checksum of migration %04d_%s: %w", version, migration.Name, err)
+			}
+			record.checksum = migration.Checksum
+			records[version] = record
+			continue
+		}
+		if migration.Checksum != record.checksum {
+			return nil, fmt.Errorf("%w: %04d_%s was changed after it was applied", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+
+	return records, nil
+}
+
+func (migration Migration) up(ctx context.Context, tx *sql.Tx, options Options) error {
+	if migration.UpFunc != nil {
+		return migration.UpFunc(ctx, tx, options)
+	}
+	_, err := tx.ExecContext(ctx, migration.UpSQL)
+	return err
+}
+
+func (migration Migration) down(ctx context.Context, tx *sql.Tx, options Options) error {
+	if migration.DownFunc != nil {
+		return migration.DownFunc(ctx, tx, options)
+	}
+	_, err := tx.ExecContext(ctx, migration.DownSQL)
+	return err
+}
+
+func (m *Migrator) apply(ctx context.Context, run MigrationFunc, bookkeeping func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := run(ctx, tx, m.Options); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := bookkeeping(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withLock runs fn while holding the row in schema_migrations_lock so that
+// two instances starting at the same time do not migrate concurrently.
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+
+	if err := m.acquireLock(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		_, err := m.db.ExecContext(context.WithoutCancel(ctx), "DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ?", m.Owner)
+		if err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	return fn()
+}
+
+func (m *Migrator) acquireLock(ctx context.Context) error {
+	deadline := time.Now().Add(m.LockTimeout)
+
+	for {
+		result, err := m.db.ExecContext(ctx,
+			"INSERT OR IGNORE INTO schema_migrations_lock (id, owner, acquired_at) VALUES (1, ?, ?)",
+			m.Owner, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		if affected, _ := result.RowsAffected(); affected == 1 {
+			return nil
+		}
+
+		var owner string
+		var acquiredAt time.Time
+		err = m.db.QueryRowContext(ctx, "SELECT owner, acquired_at FROM schema_migrations_lock WHERE id = 1").Scan(&owner, &acquiredAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to inspect migration lock: %w", err)
+		}
+
+		if err == nil && time.Since(acquiredAt) > m.StaleLockAfter {
+			log.Printf("Breaking stale migration lock held by %s since %s", owner, acquiredAt)
+			_, err := m.db.ExecContext(ctx, "DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ?", owner)
+			if err != nil {
+				return fmt.Errorf("failed to break stale migration lock: %w", err)
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s", ErrLocked, owner)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+	"user-crud/helper"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_things.up.sql":   {Data: []byte("CREATE TABLE things (id INTEGER PRIMARY KEY);")},
+		"0001_create_things.down.sql": {Data: []byte("DROP TABLE things;")},
+		"0002_add_name.up.sql":        {Data: []byte("ALTER TABLE things ADD COLUMN name TEXT;")},
+		"0002_add_name.down.sql":      {Data: []byte("ALTER TABLE things DROP COLUMN name;")},
+	}
+}
+
+func TestEmbeddedMigrationsApply(t *testing.T) {
+	db := openTestDB(t)
+
+	migrator, err := New(db)
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	pending, err := migrator.Pending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pending)
+
+	_, err = db.Exec("SELECT id, name, surname, email, phone_number, created_at FROM users")
+	assert.NoError(t, err, "users table should exist")
+}
+
+func TestEmbeddedMigrationsKeepSearchIndexInSync(t *testing.T) {
+	db := openTestDB(t)
+
+	migrator, err := New(db)
+	assert.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT NOT NULL, surname TEXT NOT NULL, email TEXT NOT NULL UNIQUE, phone_number TEXT, created_at DATETIME)")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO users (id, name, surname, email) VALUES ('1', 'Elif', 'Çelik', 'elif@example.com')")
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	_, err = db.Exec("INSERT INTO users (id, name, surname, email) VALUES ('2', 'John', 'Doe', 'john@example.com')")
+	assert.NoError(t, err)
+	_, err = db.Exec("UPDATE users SET surname = 'Smith' WHERE id = '2'")
+	assert.NoError(t, err)
+
+	search := func(query string) []string {
+		rows, err := db.Query("SELECT id FROM users_search WHERE users_search MATCH ? ORDER BY id", query)
+		assert.NoError(t, err)
+		defer rows.Close()
+
+		var ids []string
+		for rows.Next() {
+			var id string
+			assert.NoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"1"}, search("celik"), "existing users are indexed without diacritics")
+	assert.Equal(t, []string{"2"}, search("smi*"))
+	assert.Empty(t, search("doe"))
+	assert.Equal(t, []string{"1", "2"}, search("example"))
+
+	_, err = db.Exec("DELETE FROM users WHERE id = '1'")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, search("example"))
+
+	steps := len(migrator.Migrations()) - 1
+	reverted, err := migrator.Down(context.Background(), steps)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, steps)
+	assert.Equal(t, int64(2), reverted[steps-1].Version)
+
+	_, err = db.Exec("INSERT INTO users (id, name, surname, email) VALUES ('3', 'Jane', 'Doe', 'jane@example.com')")
+	assert.NoError(t, err, "triggers should be dropped with the index")
+}
+
+func TestUpRebuildsSearchIndexWithFTS5(t *testing.T) {
+	db := openTestDB(t)
+
+	migrator, err := New(db)
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	// An index created by a build without FTS5.
+	_, err = db.Exec(dropUsersSearchSQL)
+	assert.NoError(t, err)
+	_, err = db.Exec(usersSearchFTS4)
+	assert.NoError(t, err)
+	_, err = db.Exec(usersSearchTriggers)
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO users (id, name, surname, email) VALUES ('1', 'Elif', 'Çelik', 'elif@example.com')")
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	var fts5 bool
+	assert.NoError(t, db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5))
+	var definition string
+	assert.NoError(t, db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'users_search'").Scan(&definition))
+	assert.Equal(t, fts5, strings.Contains(definition, "fts5"), "the index should use FTS5 whenever it is available")
+
+	var id string
+	assert.NoError(t, db.QueryRow("SELECT id FROM users_search WHERE users_search MATCH 'celik'").Scan(&id))
+	assert.Equal(t, "1", id, "existing users should be indexed again")
+}
+
+func TestUpIsIdempotentAndDownReverts(t *testing.T) {
+	db := openTestDB(t)
+	migrator, err := NewFromFS(db, testFS())
+	assert.NoError(t, err)
+
+	applied, err := migrator.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+
+	applied, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 0)
+
+	reverted, err := migrator.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, int64(2), reverted[0].Version)
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+}
+
+func TestUpRejectsEditedMigration(t *testing.T) {
+	db := openTestDB(t)
+	migrator, err := NewFromFS(db, testFS())
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	edited := testFS()
+	edited["0001_create_things.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE things (id TEXT PRIMARY KEY);")}
+	migrator, err = NewFromFS(db, edited)
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Modified)
+}
+
+func TestUpChecksumsGoMigrationSource(t *testing.T) {
+	db := openTestDB(t)
+	migrator, err := New(db)
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	var search Migration
+	for _, migration := range migrator.Migrations() {
+		if migration.Version == 2 {
+			search = migration
+		}
+	}
+	assert.NotEqual(t, search.legacyChecksum, search.Checksum)
+
+	_, err = db.Exec("UPDATE schema_migrations SET checksum = ? WHERE version = 2", search.legacyChecksum)
+	assert.NoError(t, err)
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, statuses[1].Modified, "legacy checksums are not reported as edits")
+
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	var recorded string
+	assert.NoError(t, db.QueryRow("SELECT checksum FROM schema_migrations WHERE version = 2").Scan(&recorded))
+	assert.Equal(t, search.Checksum, recorded, "legacy checksum should be upgraded")
+
+	for i, migration := range migrator.migrations {
+		if migration.Version == 2 {
+			migrator.migrations[i].Checksum = checksum("go:"+migration.Name, usersSearchFTS5)
+		}
+	}
+
+	_, err = migrator.Up(context.Background())
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestUpWaitsForLock(t *testing.T) {
+	db := openTestDB(t)
+	migrator, err := NewFromFS(db, testFS())
+	assert.NoError(t, err)
+	migrator.LockTimeout = 300 * time.Millisecond
+
+	assert.NoError(t, migrator.ensureTables(context.Background()))
+	_, err = db.Exec("INSERT INTO schema_migrations_lock (id, owner, acquired_at) VALUES (1, 'other', ?)", time.Now().UTC())
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	assert.ErrorIs(t, err, ErrLocked)
+
+	_, err = db.Exec("UPDATE schema_migrations_lock SET acquired_at = ?", time.Now().Add(-time.Hour).UTC())
+	assert.NoError(t, err)
+
+	applied, err := migrator.Up(context.Background())
+	assert.NoError(t, err, "stale lock should be broken")
+	assert.Len(t, applied, 2)
+}
+
+func TestEmailCanonicalMigrationBackfillsAndReportsConflicts(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator, err := New(db)
+	assert.NoError(t, err)
+
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	_, err = migrator.Down(ctx, 1)
+	assert.NoError(t, err)
+
+	insert := func(id, email string, deleted bool) {
+		t.Helper()
+		var deletedAt any
+		if deleted {
+			deletedAt = time.Now().UTC()
+		}
+		_, err := db.Exec("INSERT INTO users (id, name, surname, email, phone_number, created_at, deleted_at) VALUES (?, 'John', 'Doe', ?, ?, ?, ?)",
+			id, email, "555000000"+id, time.Now().UTC(), deletedAt)
+		assert.NoError(t, err)
+	}
+	insert("1", "John@Example.com", false)
+	insert("2", "john@example.com", false)
+	insert("3", "JOHN@example.com", true)
+	insert("4", "j.doe@Gmail.com", false)
+	insert("5", "jdoe@googlemail.com", false)
+	insert("7", "john@exa_mple.com", true)
+
+	_, err = migrator.Up(ctx)
+	var invalidErr *InvalidEmailError
+	assert.ErrorAs(t, err, &invalidErr)
+	if assert.Len(t, invalidErr.Emails, 1) {
+		assert.Equal(t, "7", invalidErr.Emails[0].UserId)
+		assert.True(t, invalidErr.Emails[0].Deleted)
+	}
+	assert.Contains(t, err.Error(), "7 (john@exa_mple.com, deleted)")
+
+	_, err = db.Exec("DELETE FROM users WHERE id = '7'")
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	var collisionErr *EmailCollisionError
+	assert.ErrorAs(t, err, &collisionErr)
+	assert.Equal(t, []EmailCollision{
+		{CanonicalEmail: "john@example.com", UserIds: []string{"1", "2"}, Emails: []string{"John@Example.com", "john@example.com"}},
+	}, collisionErr.Collisions, "deleted users do not collide")
+	pending, err := migrator.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pending)
+
+	_, err = db.Exec("DELETE FROM users WHERE id = '2'")
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+
+	canonicalEmails := func() map[string]string {
+		rows, err := db.Query("SELECT id, email_canonical FROM users")
+		assert.NoError(t, err)
+		defer rows.Close()
+
+		emails := map[string]string{}
+		for rows.Next() {
+			var id, email string
+			assert.NoError(t, rows.Scan(&id, &email))
+			emails[id] = email
+		}
+		return emails
+	}
+	assert.Equal(t, map[string]string{
+		"1": "john@example.com",
+		"3": "john@example.com",
+		"4": "j.doe@gmail.com",
+		"5": "jdoe@googlemail.com",
+	}, canonicalEmails())
+
+	_, err = db.Exec("INSERT INTO users (id, name, surname, email, email_canonical, phone_number, created_at) VALUES ('6', 'John', 'Doe', 'JOHN@example.com', 'john@example.com', '5550000006', ?)", time.Now().UTC())
+	assert.Error(t, err, "canonical emails are unique among active users")
+
+	migrator.Options.EmailRules = helper.EmailRules{GmailDots: true}
+	_, err = migrator.CanonicalizeEmails(ctx)
+	assert.ErrorAs(t, err, &collisionErr)
+	assert.Equal(t, "jdoe@gmail.com", collisionErr.Collisions[0].CanonicalEmail)
+
+	_, err = db.Exec("UPDATE users SET deleted_at = ? WHERE id = '5'", time.Now().UTC())
+	assert.NoError(t, err)
+	changed, err := migrator.CanonicalizeEmails(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, "jdoe@gmail.com", canonicalEmails()["4"])
+}
@@ -0,0 +1,28 @@
+-- Restoring the UNIQUE constraints requires dropping users that are still
+-- soft-deleted.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE users_old (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    surname TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    phone_number TEXT UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users_old (rowid, id, name, surname, email, phone_number, created_at)
+SELECT rowid, id, name, surname, email, phone_number, created_at FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE TRIGGER users_search_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_search (rowid, id, name, surname, email) VALUES (new.rowid, new.id, new.name, new.surname, new.email);
+END;
+CREATE TRIGGER users_search_update AFTER UPDATE OF id, name, surname, email ON users BEGIN
+    UPDATE users_search SET id = new.id, name = new.name, surname = new.surname, email = new.email WHERE rowid = old.rowid;
+END;
+CREATE TRIGGER users_search_delete AFTER DELETE ON users BEGIN
+    DELETE FROM users_search WHERE rowid = old.rowid;
+END;
@@ -0,0 +1,34 @@
+-- Deleted users keep their row until they are purged, so email and phone
+-- number only need to be unique among users that are not deleted. SQLite
+-- cannot drop a UNIQUE constraint, so the table is rebuilt. Rowids are kept
+-- because users_search is keyed by them.
+CREATE TABLE users_new (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    surname TEXT NOT NULL,
+    email TEXT NOT NULL,
+    phone_number TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME
+);
+
+INSERT INTO users_new (rowid, id, name, surname, email, phone_number, created_at)
+SELECT rowid, id, name, surname, email, phone_number, created_at FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE UNIQUE INDEX users_email_active ON users (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_phone_number_active ON users (phone_number) WHERE deleted_at IS NULL;
+CREATE INDEX users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Dropping the old table dropped the search triggers with it.
+CREATE TRIGGER users_search_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_search (rowid, id, name, surname, email) VALUES (new.rowid, new.id, new.name, new.surname, new.email);
+END;
+CREATE TRIGGER users_search_update AFTER UPDATE OF id, name, surname, email ON users BEGIN
+    UPDATE users_search SET id = new.id, name = new.name, surname = new.surname, email = new.email WHERE rowid = old.rowid;
+END;
+CREATE TRIGGER users_search_delete AFTER DELETE ON users BEGIN
+    DELETE FROM users_search WHERE rowid = old.rowid;
+END;
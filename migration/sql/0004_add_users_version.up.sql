@@ -0,0 +1,3 @@
+-- version is incremented by every change to a user and exposed as its ETag
+-- for optimistic concurrency control.
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+-- audit_log records every change made to a user. It has no foreign key to
+-- users so that the trail outlives purged users.
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    changes TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX audit_log_user_id ON audit_log (user_id, created_at);
+CREATE INDEX audit_log_actor ON audit_log (actor, created_at);
+CREATE INDEX audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,2 @@
+DROP INDEX users_updated_at;
+ALTER TABLE users DROP COLUMN updated_at;
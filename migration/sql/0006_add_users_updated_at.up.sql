@@ -0,0 +1,6 @@
+-- updated_at is set by every change to a user. Existing users are treated as
+-- unchanged since they were created.
+ALTER TABLE users ADD COLUMN updated_at DATETIME;
+UPDATE users SET updated_at = created_at;
+
+CREATE INDEX users_updated_at ON users (updated_at);
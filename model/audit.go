@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+)
+
+// FieldChange holds the value of a field before and after a change. A nil
+// value means the field was not set.
+type FieldChange struct {
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+type AuditEntry struct {
+	Id        int64
+	Actor     string
+	Action    string
+	UserId    uuid.UUID
+	Changes   map[string]FieldChange
+	RequestId string
+	ClientIP  string
+	CreatedAt time.Time
+}
@@ -13,4 +13,7 @@ type User struct {
 	Email       string
 	PhoneNumber string
 	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time
+	Version     int64
 }
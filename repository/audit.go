@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"user-crud/helper"
+	"user-crud/model"
+
+	"github.com/google/uuid"
+)
+
+// SystemActor is recorded for changes made without a helper.RequestInfo on
+// the context, such as those made by background jobs.
+const SystemActor = "system"
+
+// auditedFields returns the fields of user that are recorded in the audit log.
+func auditedFields(user model.User) map[string]*string {
+	return map[string]*string{
+		"name":         &user.Name,
+		"surname":      &user.Surname,
+		"email":        &user.Email,
+		"phone_number": &user.PhoneNumber,
+	}
+}
+
+// diffUsers returns the audited fields that differ between before and after.
+// A nil before or after stands for a user that did not exist.
+func diffUsers(before, after *model.User) map[string]model.FieldChange {
+	beforeFields, afterFields := map[string]*string{}, map[string]*string{}
+	if before != nil {
+		beforeFields = auditedFields(*before)
+	}
+	if after != nil {
+		afterFields = auditedFields(*after)
+	}
+
+	changes := map[string]model.FieldChange{}
+	for _, fields := range []map[string]*string{beforeFields, afterFields} {
+		for field := range fields {
+			from, to := beforeFields[field], afterFields[field]
+			if from != nil && to != nil && *from == *to {
+				continue
+			}
+			changes[field] = model.FieldChange{Before: from, After: to}
+		}
+	}
+	return changes
+}
+
+func deletedAtChange(before, after *time.Time) map[string]model.FieldChange {
+	format := func(t *time.Time) *string {
+		if t == nil {
+			return nil
+		}
+		value := t.UTC().Format(time.RFC3339)
+		return &value
+	}
+	return map[string]model.FieldChange{"deleted_at": {Before: format(before), After: format(after)}}
+}
+
+// writeAudit records a change to a user in the audit log as part of tx, so the
+// entry is only kept if the change itself is committed.
+func writeAudit(ctx context.Context, tx *sql.Tx, action string, userId uuid.UUID, changes map[string]model.FieldChange) error {
+	info := helper.RequestInfoFrom(ctx)
+	if info.Actor == "" {
+		info.Actor = SystemActor
+	}
+
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+
+	SQL := "INSERT INTO audit_log (actor, action, user_id, changes, request_id, client_ip, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, SQL, info.Actor, action, userId, string(encoded), info.RequestId, info.ClientIP, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
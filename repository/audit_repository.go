@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"user-crud/model"
+
+	"github.com/google/uuid"
+)
+
+type AuditFilter struct {
+	UserId *uuid.UUID
+	Actor  string
+	From   *time.Time
+	To     *time.Time
+}
+
+type AuditQuery struct {
+	Filter AuditFilter
+	Limit  int
+	Offset int
+}
+
+type AuditPage struct {
+	Entries []model.AuditEntry
+	Total   int
+}
+
+// AuditRepository reads the audit log. Entries are written by the user
+// repository in the same transaction as the change they record.
+type AuditRepository interface {
+	FindPage(ctx context.Context, query AuditQuery) (AuditPage, error)
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"user-crud/model"
+)
+
+type AuditRepositoryImpl struct {
+	Db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &AuditRepositoryImpl{Db: db}
+}
+
+// FindPage returns one page of audit entries matching query.Filter, newest
+// first. Like the user reads, it does not run in a transaction, so it neither
+// takes nor waits for the write lock.
+func (repo *AuditRepositoryImpl) FindPage(ctx context.Context, query AuditQuery) (AuditPage, error) {
+	page := AuditPage{Entries: []model.AuditEntry{}}
+
+	var conditions []string
+	var args []interface{}
+	if query.Filter.UserId != nil {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, *query.Filter.UserId)
+	}
+	if query.Filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, query.Filter.Actor)
+	}
+	if query.Filter.From != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, query.Filter.From.UTC())
+	}
+	if query.Filter.To != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, query.Filter.To.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	SQL := "SELECT COUNT(*) FROM audit_log" + where
+	if err := repo.Db.QueryRowContext(ctx, SQL, args...).Scan(&page.Total); err != nil {
+		return AuditPage{}, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	SQL = "SELECT id, actor, action, user_id, changes, request_id, client_ip, created_at FROM audit_log" +
+		where + " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	result, err := repo.Db.QueryContext(ctx, SQL, append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return AuditPage{}, fmt.Errorf("failed to execute query to find audit entries: %w", err)
+	}
+	defer result.Close()
+
+	for result.Next() {
+		entry := model.AuditEntry{}
+		var changes string
+		err := result.Scan(&entry.Id, &entry.Actor, &entry.Action, &entry.UserId, &changes, &entry.RequestId, &entry.ClientIP, &entry.CreatedAt)
+		if err != nil {
+			return AuditPage{}, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return AuditPage{}, fmt.Errorf("failed to decode changes of audit entry %d: %w", entry.Id, err)
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if err := result.Err(); err != nil {
+		return AuditPage{}, err
+	}
+
+	return page, nil
+}
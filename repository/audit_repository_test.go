@@ -0,0 +1,75 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-crud/helper"
+	"user-crud/model"
+	"user-crud/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserMutationsAreAudited(t *testing.T) {
+	db := openMigratedDB(t)
+	as := func(actor string) context.Context {
+		return helper.WithRequestInfo(context.Background(), helper.RequestInfo{Actor: actor, RequestId: "req-" + actor, ClientIP: "192.0.2.1"})
+	}
+
+	repo := newRepository(t, db)
+	audit := repository.NewAuditRepository(db)
+
+	assert.NoError(t, repo.Save(as("alice"), model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+	user, err := repo.FindByEmail(context.Background(), "john.doe@example.com")
+	assert.NoError(t, err)
+
+	renamed := user
+	renamed.Name = "Johnny"
+	assert.NoError(t, repo.Update(as("bob"), user.Id, renamed))
+
+	// A rejected write must not leave an entry behind.
+	assert.Error(t, repo.Update(as("mallory"), user.Id, renamed))
+
+	assert.NoError(t, repo.Delete(as("alice"), user.Id, 2))
+	assert.NoError(t, repo.Restore(context.Background(), user.Id))
+
+	page, err := audit.FindPage(context.Background(), repository.AuditQuery{Filter: repository.AuditFilter{UserId: &user.Id}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, page.Total)
+
+	var actions, actors []string
+	for _, entry := range page.Entries {
+		actions = append(actions, entry.Action)
+		actors = append(actors, entry.Actor)
+	}
+	assert.Equal(t, []string{model.AuditActionRestore, model.AuditActionDelete, model.AuditActionUpdate, model.AuditActionCreate}, actions)
+	assert.Equal(t, []string{repository.SystemActor, "alice", "bob", "alice"}, actors)
+
+	update := page.Entries[2]
+	assert.Equal(t, "req-bob", update.RequestId)
+	assert.Equal(t, "192.0.2.1", update.ClientIP)
+	assert.Len(t, update.Changes, 1, "only changed fields are recorded")
+	assert.Equal(t, "John", *update.Changes["name"].Before)
+	assert.Equal(t, "Johnny", *update.Changes["name"].After)
+
+	create := page.Entries[3]
+	assert.Nil(t, create.Changes["email"].Before)
+	assert.Equal(t, "john.doe@example.com", *create.Changes["email"].After)
+
+	assert.NotNil(t, page.Entries[1].Changes["deleted_at"].After)
+	assert.Nil(t, page.Entries[0].Changes["deleted_at"].After)
+
+	page, err = audit.FindPage(context.Background(), repository.AuditQuery{Filter: repository.AuditFilter{Actor: "alice"}, Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	if assert.Len(t, page.Entries, 1) {
+		assert.Equal(t, model.AuditActionCreate, page.Entries[0].Action)
+	}
+
+	future := time.Now().Add(time.Hour)
+	page, err = audit.FindPage(context.Background(), repository.AuditQuery{Filter: repository.AuditFilter{From: &future}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, page.Total)
+	assert.Empty(t, page.Entries)
+}
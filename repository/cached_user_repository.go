@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-crud/model"
+
+	"github.com/google/uuid"
+)
+
+// CacheOptions configures a CachedUserRepository.
+type CacheOptions struct {
+	// Size is how many lookups are kept. The least recently used one is
+	// evicted when the cache is full.
+	Size int
+	// TTL is how long a found user is served from the cache.
+	TTL time.Duration
+	// NegativeTTL is how long a lookup that found no user is remembered.
+	// Zero disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// CacheStats counts the lookups a CachedUserRepository answered itself
+// (Hits) and the ones it passed on (Misses).
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+type cacheKey struct {
+	field string
+	value string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	user    model.User
+	err     error
+	expires time.Time
+}
+
+// CachedUserRepository is a read-through cache for FindById, FindByEmail and
+// FindByPhoneNumber in front of another UserRepository. Writes made through
+// it invalidate the lookups they affect; writes made elsewhere, such as by
+// another process, are only seen once the entries expire.
+type CachedUserRepository struct {
+	UserRepository
+
+	options CacheOptions
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	// byUser holds the keys of the entries that found each user.
+	byUser map[uuid.UUID]map[cacheKey]struct{}
+	// generation changes on every invalidation, so a lookup that raced with
+	// a write does not store what it read before the write.
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewCachedUserRepository(next UserRepository, options CacheOptions) *CachedUserRepository {
+	return &CachedUserRepository{
+		UserRepository: next,
+		options:        options,
+		entries:        map[cacheKey]*list.Element{},
+		lru:            list.New(),
+		byUser:         map[uuid.UUID]map[cacheKey]struct{}{},
+	}
+}
+
+// Stats returns the cache counters.
+func (repo *CachedUserRepository) Stats() CacheStats {
+	repo.mu.Lock()
+	entries := repo.lru.Len()
+	repo.mu.Unlock()
+
+	return CacheStats{Hits: repo.hits.Load(), Misses: repo.misses.Load(), Entries: entries}
+}
+
+func (repo *CachedUserRepository) FindById(ctx context.Context, userId uuid.UUID) (model.User, error) {
+	return repo.find(cacheKey{"id", userId.String()}, func() (model.User, error) {
+		return repo.UserRepository.FindById(ctx, userId)
+	})
+}
+
+func (repo *CachedUserRepository) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	return repo.find(repo.emailKey(email), func() (model.User, error) {
+		return repo.UserRepository.FindByEmail(ctx, email)
+	})
+}
+
+func (repo *CachedUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (model.User, error) {
+	return repo.find(cacheKey{"phone_number", phoneNumber}, func() (model.User, error) {
+		return repo.UserRepository.FindByPhoneNumber(ctx, phoneNumber)
+	})
+}
+
+func (repo *CachedUserRepository) Save(ctx context.Context, user model.User) error {
+	err := repo.UserRepository.Save(ctx, user)
+	repo.invalidate(user.Id, user)
+	return err
+}
+
+func (repo *CachedUserRepository) SaveAll(ctx context.Context, users []model.User, atomic bool) ([]SaveResult, error) {
+	results, err := repo.UserRepository.SaveAll(ctx, users, atomic)
+	for _, user := range users {
+		repo.invalidate(user.Id, user)
+	}
+	return results, err
+}
+
+func (repo *CachedUserRepository) Update(ctx context.Context, userId uuid.UUID, user model.User) error {
+	err := repo.UserRepository.Update(ctx, userId, user)
+	repo.invalidate(userId, user)
+	return err
+}
+
+func (repo *CachedUserRepository) Delete(ctx context.Context, userId uuid.UUID, version int64) error {
+	err := repo.UserRepository.Delete(ctx, userId, version)
+	repo.invalidate(userId, model.User{})
+	return err
+}
+
+// Restore clears the whole cache: the restored user's email and phone number
+// are not known here, and lookups of them may be cached as not found.
+func (repo *CachedUserRepository) Restore(ctx context.Context, userId uuid.UUID) error {
+	err := repo.UserRepository.Restore(ctx, userId)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.generation++
+	repo.entries = map[cacheKey]*list.Element{}
+	repo.lru.Init()
+	repo.byUser = map[uuid.UUID]map[cacheKey]struct{}{}
+
+	return err
+}
+
+// Drain waits for the wrapped repository to finish its work, if it tracks
+// any.
+func (repo *CachedUserRepository) Drain(ctx context.Context) error {
+	if drainer, ok := repo.UserRepository.(Drainer); ok {
+		return drainer.Drain(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped repository, if it needs closing.
+func (repo *CachedUserRepository) Close() error {
+	if closer, ok := repo.UserRepository.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// find answers a lookup from the cache, or from load and remembers the
+// result. Only ErrNotFound is remembered of the errors.
+func (repo *CachedUserRepository) find(key cacheKey, load func() (model.User, error)) (model.User, error) {
+	repo.mu.Lock()
+	if element, ok := repo.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			repo.lru.MoveToFront(element)
+			repo.mu.Unlock()
+			repo.hits.Add(1)
+			return entry.user, entry.err
+		}
+		repo.remove(element)
+	}
+	generation := repo.generation
+	repo.mu.Unlock()
+
+	repo.misses.Add(1)
+	user, err := load()
+
+	ttl := repo.options.TTL
+	if errors.Is(err, ErrNotFound) {
+		ttl = repo.options.NegativeTTL
+	} else if err != nil {
+		return user, err
+	}
+	if ttl <= 0 {
+		return user, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if generation != repo.generation {
+		return user, err
+	}
+	if element, ok := repo.entries[key]; ok {
+		repo.remove(element)
+	}
+
+	repo.entries[key] = repo.lru.PushFront(&cacheEntry{key: key, user: user, err: err, expires: time.Now().Add(ttl)})
+	if err == nil {
+		if repo.byUser[user.Id] == nil {
+			repo.byUser[user.Id] = map[cacheKey]struct{}{}
+		}
+		repo.byUser[user.Id][key] = struct{}{}
+	}
+	for repo.lru.Len() > repo.options.Size {
+		repo.remove(repo.lru.Back())
+	}
+
+	return user, err
+}
+
+// invalidate drops every lookup that found userId, and the lookups of the
+// email and phone number of user, which may have found nobody before.
+func (repo *CachedUserRepository) invalidate(userId uuid.UUID, user model.User) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.generation++
+
+	keys := []cacheKey{repo.emailKey(user.Email), {"phone_number", user.PhoneNumber}}
+	if userId != uuid.Nil {
+		keys = append(keys, cacheKey{"id", userId.String()})
+		for key := range repo.byUser[userId] {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		if element, ok := repo.entries[key]; ok {
+			repo.remove(element)
+		}
+	}
+}
+
+// CanonicalEmail returns the canonical form of email of the wrapped
+// repository, or email itself if it compares emails as they are.
+func (repo *CachedUserRepository) CanonicalEmail(email string) (string, error) {
+	if canonicalizer, ok := repo.UserRepository.(EmailCanonicalizer); ok {
+		return canonicalizer.CanonicalEmail(email)
+	}
+	return email, nil
+}
+
+// emailKey keys email lookups by canonical email, so that a write
+// invalidates every spelling of the email.
+func (repo *CachedUserRepository) emailKey(email string) cacheKey {
+	if canonicalEmail, err := repo.CanonicalEmail(email); err == nil {
+		return cacheKey{"email", canonicalEmail}
+	}
+	return cacheKey{"email", email}
+}
+
+func (repo *CachedUserRepository) remove(element *list.Element) {
+	entry := repo.lru.Remove(element).(*cacheEntry)
+	delete(repo.entries, entry.key)
+
+	if entry.err == nil {
+		delete(repo.byUser[entry.user.Id], entry.key)
+		if len(repo.byUser[entry.user.Id]) == 0 {
+			delete(repo.byUser, entry.user.Id)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-crud/model"
+	"user-crud/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCachedRepository(t *testing.T, options repository.CacheOptions) (*repository.CachedUserRepository, model.User) {
+	db := openMigratedDB(t)
+	cache := repository.NewCachedUserRepository(newRepository(t, db), options)
+
+	ctx := context.Background()
+	assert.NoError(t, cache.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+	user, err := cache.FindByEmail(ctx, "john.doe@example.com")
+	assert.NoError(t, err)
+
+	return cache, user
+}
+
+func TestCachedUserRepositoryInvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	cache, user := newCachedRepository(t, repository.CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		found, err := cache.FindById(ctx, user.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, "John", found.Name)
+	}
+	assert.Equal(t, repository.CacheStats{Hits: 2, Misses: 2, Entries: 2}, cache.Stats())
+
+	updated := user
+	updated.Name = "Johnny"
+	updated.Email = "johnny.doe@example.com"
+	assert.NoError(t, cache.Update(ctx, user.Id, updated))
+
+	found, err := cache.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Johnny", found.Name)
+	_, err = cache.FindByEmail(ctx, "john.doe@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "the old email must not be served from the cache")
+
+	assert.NoError(t, cache.Delete(ctx, user.Id, found.Version))
+	_, err = cache.FindById(ctx, user.Id)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = cache.FindByPhoneNumber(ctx, user.PhoneNumber)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	assert.NoError(t, cache.Restore(ctx, user.Id))
+	_, err = cache.FindByPhoneNumber(ctx, user.PhoneNumber)
+	assert.NoError(t, err, "restoring must drop cached misses")
+}
+
+func TestCachedUserRepositoryCachesMisses(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newCachedRepository(t, repository.CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+
+	missingId := uuid.New()
+	for i := 0; i < 2; i++ {
+		_, err := cache.FindById(ctx, missingId)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = cache.FindByEmail(ctx, "jane.doe@example.com")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	}
+	assert.Equal(t, int64(2), cache.Stats().Hits)
+
+	assert.NoError(t, cache.Save(ctx, model.User{Id: missingId, Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()}))
+	jane, err := cache.FindByEmail(ctx, "jane.doe@example.com")
+	assert.NoError(t, err, "saving must drop the cached miss")
+	assert.Equal(t, "Jane", jane.Name)
+	jane, err = cache.FindById(ctx, missingId)
+	assert.NoError(t, err, "saving under an id must drop the cached miss of the id")
+	assert.Equal(t, "Jane", jane.Name)
+}
+
+func TestCachedUserRepositoryExpiresAndEvicts(t *testing.T) {
+	ctx := context.Background()
+	cache, user := newCachedRepository(t, repository.CacheOptions{Size: 2, TTL: 50 * time.Millisecond})
+
+	_, err := cache.FindByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = cache.FindByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Equal(t, int64(0), cache.Stats().Hits, "misses are not cached without a negative TTL")
+
+	_, err = cache.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	_, err = cache.FindByPhoneNumber(ctx, user.PhoneNumber)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cache.Stats().Entries, "the least recently used entry is evicted")
+
+	time.Sleep(60 * time.Millisecond)
+	before := cache.Stats()
+	_, err = cache.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Misses+1, cache.Stats().Misses, "expired entries are read again")
+}
+
+func TestCachedUserRepositoryForwardsDrain(t *testing.T) {
+	cache, user := newCachedRepository(t, repository.CacheOptions{Size: 10, TTL: time.Minute})
+
+	var repo repository.UserRepository = cache
+	assert.NoError(t, repo.(repository.Drainer).Drain(context.Background()))
+
+	_, err := repo.FindByEmail(context.Background(), user.Email)
+	assert.NoError(t, err, "cached users are still served")
+	_, err = repo.FindById(context.Background(), user.Id)
+	assert.ErrorIs(t, err, repository.ErrShuttingDown)
+}
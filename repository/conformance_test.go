@@ -0,0 +1,61 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+	"user-crud/config"
+	"user-crud/helper"
+	"user-crud/migration"
+	"user-crud/repository"
+	"user-crud/repository/repositorytest"
+)
+
+// openConfiguredDB opens a migrated SQLite file with the server's default
+// settings, so concurrent writers queue like they do in production.
+func openConfiguredDB(t testing.TB) *sql.DB {
+	cfg := config.Default().Database
+	cfg.Path = filepath.Join(t.TempDir(), "users.db")
+
+	db, err := sql.Open("sqlite3", cfg.DSN())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.New(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	return db
+}
+
+func TestUserRepositoryImplConformance(t *testing.T) {
+	repositorytest.RunConformance(t, func(t *testing.T) repository.UserRepository {
+		return newRepository(t, openConfiguredDB(t))
+	})
+}
+
+func TestMemoryUserRepositoryConformance(t *testing.T) {
+	repositorytest.RunConformance(t, func(t *testing.T) repository.UserRepository {
+		return repository.NewMemoryUserRepository(helper.EmailRules{})
+	})
+}
+
+func TestCachedUserRepositoryConformance(t *testing.T) {
+	repositorytest.RunConformance(t, func(t *testing.T) repository.UserRepository {
+		return repository.NewCachedUserRepository(newRepository(t, openConfiguredDB(t)), repository.CacheOptions{
+			Size:        100,
+			TTL:         time.Minute,
+			NegativeTTL: time.Minute,
+		})
+	})
+}
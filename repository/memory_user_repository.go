@@ -0,0 +1,721 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"user-crud/helper"
+	"user-crud/model"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MemoryUserRepository keeps users and their audit log in memory. It enforces
+// the same rules as the SQL schema: canonical email and phone number are
+// unique among users that are not deleted. Nothing is persisted, so it is
+// meant for development and tests.
+type MemoryUserRepository struct {
+	emailRules helper.EmailRules
+
+	mu    sync.RWMutex
+	users map[uuid.UUID]model.User
+	// emails and phoneNumbers index the users that are not deleted, emails
+	// by their canonical form.
+	emails       map[string]uuid.UUID
+	phoneNumbers map[string]uuid.UUID
+	audit        []model.AuditEntry
+}
+
+func NewMemoryUserRepository(emailRules helper.EmailRules) *MemoryUserRepository {
+	return &MemoryUserRepository{
+		emailRules:   emailRules,
+		users:        map[uuid.UUID]model.User{},
+		emails:       map[string]uuid.UUID{},
+		phoneNumbers: map[string]uuid.UUID{},
+	}
+}
+
+// AuditRepository returns an AuditRepository that reads the audit log kept
+// by repo.
+func (repo *MemoryUserRepository) AuditRepository() AuditRepository {
+	return memoryAuditRepository{repo: repo}
+}
+
+// Load adds users as they are, keeping their ids and timestamps, without
+// recording them in the audit log. Missing ids, timestamps and versions are
+// filled in. Nothing is added unless every user can be.
+func (repo *MemoryUserRepository) Load(users []model.User) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var loaded []uuid.UUID
+	for i, user := range users {
+		if user.Id == uuid.Nil {
+			user.Id = uuid.New()
+		}
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = time.Now()
+		}
+		user.CreatedAt = user.CreatedAt.UTC()
+		if user.UpdatedAt.IsZero() {
+			user.UpdatedAt = user.CreatedAt
+		}
+		user.UpdatedAt = user.UpdatedAt.UTC()
+		if user.Version == 0 {
+			user.Version = 1
+		}
+
+		if err := repo.insert(user); err != nil {
+			for _, userId := range loaded {
+				repo.remove(userId)
+			}
+			return fmt.Errorf("failed to load user %d: %w", i, err)
+		}
+		loaded = append(loaded, user.Id)
+	}
+
+	return nil
+}
+
+func (repo *MemoryUserRepository) Save(ctx context.Context, user model.User) error {
+	user = newMemoryUser(user)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if err := repo.insert(user); err != nil {
+		return err
+	}
+	repo.writeAudit(ctx, model.AuditActionCreate, user.Id, diffUsers(nil, &user))
+	return nil
+}
+
+// SaveAll saves users and reports the outcome for each of them in order. With
+// atomic, nothing is saved unless every user can be.
+func (repo *MemoryUserRepository) SaveAll(ctx context.Context, users []model.User, atomic bool) ([]SaveResult, error) {
+	results := make([]SaveResult, len(users))
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	audited := len(repo.audit)
+	var saved []uuid.UUID
+	for i, user := range users {
+		user = newMemoryUser(user)
+
+		err := repo.insert(user)
+		if err == nil {
+			repo.writeAudit(ctx, model.AuditActionCreate, user.Id, diffUsers(nil, &user))
+			saved = append(saved, user.Id)
+		}
+		results[i] = SaveResult{Id: user.Id, Err: err}
+	}
+
+	if atomic && len(saved) < len(users) {
+		for _, userId := range saved {
+			repo.remove(userId)
+		}
+		repo.audit = repo.audit[:audited]
+	}
+
+	return results, nil
+}
+
+// newMemoryUser returns user as Save stores it: with a new id, at its first
+// version and not yet updated.
+func newMemoryUser(user model.User) model.User {
+	if user.Id == uuid.Nil {
+		user.Id = uuid.New()
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	user.UpdatedAt = user.CreatedAt
+	user.DeletedAt = nil
+	user.Version = 1
+	return user
+}
+
+// Update saves user if it is still at user.Version and increments the
+// version. It fails like UserRepositoryImpl.Update.
+func (repo *MemoryUserRepository) Update(ctx context.Context, userId uuid.UUID, user model.User) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	before, err := repo.current(userId, user.Version)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.CanonicalEmail(user.Email); err != nil {
+		return err
+	}
+	if err := repo.checkUnique(userId, user.Email, user.PhoneNumber); err != nil {
+		return err
+	}
+
+	after := before
+	after.Name = user.Name
+	after.Surname = user.Surname
+	after.Email = user.Email
+	after.PhoneNumber = user.PhoneNumber
+	after.UpdatedAt = time.Now().UTC()
+	after.Version++
+
+	repo.remove(userId)
+	repo.store(after)
+	repo.writeAudit(ctx, model.AuditActionUpdate, userId, diffUsers(&before, &after))
+	return nil
+}
+
+// Delete soft-deletes the user if it is still at version.
+func (repo *MemoryUserRepository) Delete(ctx context.Context, userId uuid.UUID, version int64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	user, err := repo.current(userId, version)
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now().UTC()
+	user.DeletedAt = &deletedAt
+	user.UpdatedAt = deletedAt
+	user.Version++
+
+	repo.remove(userId)
+	repo.store(user)
+	repo.writeAudit(ctx, model.AuditActionDelete, userId, deletedAtChange(nil, &deletedAt))
+	return nil
+}
+
+// current returns the active user with userId if it is at version, and
+// otherwise ErrNotFound or a *VersionConflictError.
+func (repo *MemoryUserRepository) current(userId uuid.UUID, version int64) (model.User, error) {
+	user, ok := repo.users[userId]
+	if !ok || user.DeletedAt != nil {
+		return model.User{}, fmt.Errorf("%w: %s", ErrNotFound, userId)
+	}
+	if user.Version != version {
+		return model.User{}, &VersionConflictError{UserId: userId, Expected: version, Current: user.Version}
+	}
+	return user, nil
+}
+
+// Restore undoes Delete. It fails with ErrUserNotDeleted when there is no
+// deleted user with userId, including when it has already been purged.
+func (repo *MemoryUserRepository) Restore(ctx context.Context, userId uuid.UUID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	user, ok := repo.users[userId]
+	if !ok || user.DeletedAt == nil {
+		return fmt.Errorf("%w: %s", ErrUserNotDeleted, userId)
+	}
+	if err := repo.checkUnique(userId, user.Email, user.PhoneNumber); err != nil {
+		return fmt.Errorf("%w: %s", ErrRestoreConflict, userId)
+	}
+
+	deletedAt := user.DeletedAt
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now().UTC()
+	user.Version++
+
+	repo.store(user)
+	repo.writeAudit(ctx, model.AuditActionRestore, userId, deletedAtChange(deletedAt, nil))
+	return nil
+}
+
+// Purge permanently removes users that were deleted before deletedBefore and
+// returns how many were removed.
+func (repo *MemoryUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var purged int64
+	for userId, user := range repo.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			repo.remove(userId)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// FindById returns the active user with userId, or ErrNotFound.
+func (repo *MemoryUserRepository) FindById(ctx context.Context, userId uuid.UUID) (model.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	user, ok := repo.users[userId]
+	if !ok || user.DeletedAt != nil {
+		return model.User{}, fmt.Errorf("%w: %s", ErrNotFound, userId)
+	}
+	return user, nil
+}
+
+// CanonicalEmail returns the form of email that users are unique and looked
+// up by.
+func (repo *MemoryUserRepository) CanonicalEmail(email string) (string, error) {
+	return helper.CanonicalEmail(email, repo.emailRules)
+}
+
+// emailKey returns the key of email in repo.emails. Only emails that have a
+// canonical form are stored.
+func (repo *MemoryUserRepository) emailKey(email string) string {
+	canonicalEmail, _ := repo.CanonicalEmail(email)
+	return canonicalEmail
+}
+
+// FindByEmail returns the active user whose email has the same canonical
+// form as email, or ErrNotFound. An email without a canonical form fails with
+// helper.ErrInvalidEmail.
+func (repo *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	canonicalEmail, err := repo.CanonicalEmail(email)
+	if err != nil {
+		return model.User{}, err
+	}
+	return repo.findIndexed(repo.emails, canonicalEmail)
+}
+
+// FindByPhoneNumber returns the active user with phoneNumber, or ErrNotFound.
+func (repo *MemoryUserRepository) FindByPhoneNumber(ctx context.Context, phoneNumber string) (model.User, error) {
+	return repo.findIndexed(repo.phoneNumbers, phoneNumber)
+}
+
+func (repo *MemoryUserRepository) findIndexed(index map[string]uuid.UUID, value string) (model.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	userId, ok := index[value]
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+	return repo.users[userId], nil
+}
+
+// FindAll returns the active users, oldest first.
+func (repo *MemoryUserRepository) FindAll(ctx context.Context) ([]model.User, error) {
+	users := repo.list(UserFilter{})
+	sortUsers(users, []SortField{{Field: "created_at"}})
+	return users, nil
+}
+
+// FindPage returns one page of users matching query.Filter in the order given
+// by query.Sort. With a cursor the page is located by keyset, otherwise by
+// query.Offset.
+func (repo *MemoryUserRepository) FindPage(ctx context.Context, query UserQuery) (UserPage, error) {
+	fields := query.Sort
+	if len(fields) == 0 {
+		fields, _ = ParseSort(DefaultSort)
+	}
+
+	var position model.User
+	if query.Cursor != nil {
+		var err error
+		if position, err = cursorPosition(fields, query.Cursor); err != nil {
+			return UserPage{}, err
+		}
+	}
+
+	users := repo.list(query.Filter)
+	sortUsers(users, fields)
+	page := UserPage{Users: []model.User{}, Total: len(users)}
+
+	before := query.Cursor != nil && query.Cursor.Before
+	var start, end int
+	switch {
+	case query.Cursor == nil:
+		start = min(query.Offset, len(users))
+		end = min(start+query.Limit, len(users))
+	case before:
+		end = sort.Search(len(users), func(i int) bool { return compareUsers(fields, users[i], position) >= 0 })
+		start = max(end-query.Limit, 0)
+	default:
+		start = sort.Search(len(users), func(i int) bool { return compareUsers(fields, users[i], position) > 0 })
+		end = min(start+query.Limit, len(users))
+	}
+	page.Users = append(page.Users, users[start:end]...)
+	if len(page.Users) == 0 {
+		return page, nil
+	}
+
+	hasMore := end < len(users)
+	if before {
+		hasMore = start > 0
+	}
+
+	hasNext, hasPrev := hasMore, query.Offset > 0
+	if query.Cursor != nil {
+		hasNext, hasPrev = before || hasMore, !before || hasMore
+	}
+
+	first, last := page.Users[0], page.Users[len(page.Users)-1]
+	if hasNext {
+		page.NextCursor = cursorFor(fields, last, memoryTimestamps(last), false)
+	}
+	if hasPrev {
+		page.PrevCursor = cursorFor(fields, first, memoryTimestamps(first), true)
+	}
+
+	return page, nil
+}
+
+// Export calls fn for every user matching filter, oldest first, stopping at
+// the first error fn returns. fn is called without holding the lock.
+func (repo *MemoryUserRepository) Export(ctx context.Context, filter UserFilter, fn func(user model.User) error) error {
+	users := repo.list(filter)
+	sortUsers(users, []SortField{{Field: "created_at"}})
+
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search finds active users whose name, surname or email contain words
+// starting with every word of query, ignoring case and diacritics. Results
+// are ordered by name like the FTS4 fallback of UserRepositoryImpl.Search.
+func (repo *MemoryUserRepository) Search(ctx context.Context, query string, page Page) (SearchPage, error) {
+	terms, err := searchTerms(query)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	for i, term := range terms {
+		terms[i] = foldSearchText(term)
+	}
+
+	users := repo.list(UserFilter{})
+	sortUsers(users, []SortField{{Field: "name"}, {Field: "surname"}})
+
+	searchPage := SearchPage{Results: []SearchResult{}}
+	for _, user := range users {
+		snippet, ok := searchSnippet(user, terms)
+		if !ok {
+			continue
+		}
+		searchPage.Total++
+		if searchPage.Total > page.Offset && len(searchPage.Results) < page.Limit {
+			searchPage.Results = append(searchPage.Results, SearchResult{User: user, Snippet: snippet})
+		}
+	}
+
+	return searchPage, nil
+}
+
+// insert adds user, failing with ErrDuplicateEmail or ErrDuplicatePhoneNumber
+// when it is active and another active user has the same email or phone
+// number.
+func (repo *MemoryUserRepository) insert(user model.User) error {
+	if _, ok := repo.users[user.Id]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateId, user.Id)
+	}
+	if _, err := repo.CanonicalEmail(user.Email); err != nil {
+		return err
+	}
+	if user.DeletedAt == nil {
+		if err := repo.checkUnique(user.Id, user.Email, user.PhoneNumber); err != nil {
+			return err
+		}
+	}
+
+	repo.store(user)
+	return nil
+}
+
+// checkUnique reports whether an active user other than userId has email or
+// phoneNumber.
+func (repo *MemoryUserRepository) checkUnique(userId uuid.UUID, email, phoneNumber string) error {
+	if owner, ok := repo.emails[repo.emailKey(email)]; ok && owner != userId {
+		return fmt.Errorf("%w: %s", ErrDuplicateEmail, email)
+	}
+	if owner, ok := repo.phoneNumbers[phoneNumber]; ok && owner != userId {
+		return fmt.Errorf("%w: %s", ErrDuplicatePhoneNumber, phoneNumber)
+	}
+	return nil
+}
+
+func (repo *MemoryUserRepository) store(user model.User) {
+	repo.users[user.Id] = user
+	if user.DeletedAt == nil {
+		repo.emails[repo.emailKey(user.Email)] = user.Id
+		repo.phoneNumbers[user.PhoneNumber] = user.Id
+	}
+}
+
+func (repo *MemoryUserRepository) remove(userId uuid.UUID) {
+	user, ok := repo.users[userId]
+	if !ok {
+		return
+	}
+	if user.DeletedAt == nil {
+		delete(repo.emails, repo.emailKey(user.Email))
+		delete(repo.phoneNumbers, user.PhoneNumber)
+	}
+	delete(repo.users, userId)
+}
+
+// list returns copies of the users matching filter, in no particular order.
+func (repo *MemoryUserRepository) list(filter UserFilter) []model.User {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var users []model.User
+	for _, user := range repo.users {
+		if !filterMatches(filter, user) {
+			continue
+		}
+		if user.DeletedAt != nil {
+			deletedAt := *user.DeletedAt
+			user.DeletedAt = &deletedAt
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// writeAudit records a change to a user in the audit log. The caller must
+// hold the write lock.
+func (repo *MemoryUserRepository) writeAudit(ctx context.Context, action string, userId uuid.UUID, changes map[string]model.FieldChange) {
+	info := helper.RequestInfoFrom(ctx)
+	if info.Actor == "" {
+		info.Actor = SystemActor
+	}
+
+	repo.audit = append(repo.audit, model.AuditEntry{
+		Id:        int64(len(repo.audit) + 1),
+		Actor:     info.Actor,
+		Action:    action,
+		UserId:    userId,
+		Changes:   changes,
+		RequestId: info.RequestId,
+		ClientIP:  info.ClientIP,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// filterMatches reports whether user matches filter the way
+// filterConditions selects it.
+func filterMatches(filter UserFilter, user model.User) bool {
+	switch {
+	case !filter.IncludeDeleted && user.DeletedAt != nil:
+		return false
+	case filter.Name != "" && !strings.EqualFold(user.Name, filter.Name):
+		return false
+	case filter.Surname != "" && !strings.EqualFold(user.Surname, filter.Surname):
+		return false
+	case filter.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(user.Email), "@"+strings.ToLower(filter.EmailDomain)):
+		return false
+	case filter.CreatedFrom != nil && user.CreatedAt.Before(*filter.CreatedFrom):
+		return false
+	case filter.CreatedTo != nil && user.CreatedAt.After(*filter.CreatedTo):
+		return false
+	case filter.UpdatedSince != nil && user.UpdatedAt.Before(*filter.UpdatedSince):
+		return false
+	}
+	return true
+}
+
+func sortUsers(users []model.User, fields []SortField) {
+	sort.Slice(users, func(i, j int) bool {
+		return compareUsers(fields, users[i], users[j]) < 0
+	})
+}
+
+// compareUsers orders a and b by fields and then by id, like orderByClause.
+func compareUsers(fields []SortField, a, b model.User) int {
+	for _, field := range fields {
+		var result int
+		switch field.Field {
+		case "name":
+			result = strings.Compare(a.Name, b.Name)
+		case "surname":
+			result = strings.Compare(a.Surname, b.Surname)
+		case "email":
+			result = strings.Compare(a.Email, b.Email)
+		case "created_at":
+			result = a.CreatedAt.Compare(b.CreatedAt)
+		case "updated_at":
+			result = a.UpdatedAt.Compare(b.UpdatedAt)
+		}
+		if field.Desc {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return strings.Compare(a.Id.String(), b.Id.String())
+}
+
+// memoryTimestamps formats the timestamps of user for a cursor.
+func memoryTimestamps(user model.User) rawTimestamps {
+	return rawTimestamps{
+		CreatedAt: user.CreatedAt.Format(time.RFC3339Nano),
+		UpdatedAt: user.UpdatedAt.Format(time.RFC3339Nano),
+	}
+}
+
+// cursorPosition returns a user holding the sort keys of cursor, to compare
+// the listed users against.
+func cursorPosition(fields []SortField, cursor *Cursor) (model.User, error) {
+	if err := checkCursor(fields, cursor); err != nil {
+		return model.User{}, err
+	}
+
+	userId, err := uuid.Parse(cursor.Id)
+	if err != nil {
+		return model.User{}, ErrInvalidCursor
+	}
+	position := model.User{Id: userId}
+
+	for i, field := range fields {
+		value := cursor.Values[i]
+		switch field.Field {
+		case "name":
+			position.Name = value
+		case "surname":
+			position.Surname = value
+		case "email":
+			position.Email = value
+		case "created_at":
+			position.CreatedAt, err = time.Parse(time.RFC3339Nano, value)
+		case "updated_at":
+			position.UpdatedAt, err = time.Parse(time.RFC3339Nano, value)
+		}
+		if err != nil {
+			return model.User{}, ErrInvalidCursor
+		}
+	}
+
+	return position, nil
+}
+
+// searchSnippet reports whether every term starts a word of the name,
+// surname or email of user and returns the first of them that matched, with
+// the matching words marked.
+func searchSnippet(user model.User, terms []string) (string, bool) {
+	fields := []string{user.Name, user.Surname, user.Email}
+
+	var words []string
+	for _, field := range fields {
+		words = append(words, strings.FieldsFunc(foldSearchText(field), isSeparator)...)
+	}
+	for _, term := range terms {
+		if !startsAnyWord(words, term) {
+			return "", false
+		}
+	}
+
+	for _, field := range fields {
+		if snippet, matched := highlight(field, terms); matched {
+			return snippet, true
+		}
+	}
+	return "", false
+}
+
+// highlight HTML-escapes text and wraps its words that start with one of
+// terms in SnippetStart and SnippetEnd.
+func highlight(text string, terms []string) (string, bool) {
+	var snippet strings.Builder
+	matched := false
+
+	for len(text) > 0 {
+		end := strings.IndexFunc(text, isSeparator)
+		if end == 0 {
+			_, size := utf8.DecodeRuneInString(text)
+			snippet.WriteString(html.EscapeString(text[:size]))
+			text = text[size:]
+			continue
+		}
+		if end < 0 {
+			end = len(text)
+		}
+
+		word := text[:end]
+		if startsWithAny(foldSearchText(word), terms) {
+			snippet.WriteString(SnippetStart + html.EscapeString(word) + SnippetEnd)
+			matched = true
+		} else {
+			snippet.WriteString(html.EscapeString(word))
+		}
+		text = text[end:]
+	}
+
+	return snippet.String(), matched
+}
+
+// foldSearchText lower-cases text and removes its diacritics, like the
+// unicode61 tokenizer of the search index does.
+func foldSearchText(text string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		folded = text
+	}
+	return strings.ToLower(folded)
+}
+
+func startsAnyWord(words []string, term string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func startsWithAny(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryAuditRepository struct {
+	repo *MemoryUserRepository
+}
+
+// FindPage returns one page of audit entries matching query.Filter, newest
+// first.
+func (audit memoryAuditRepository) FindPage(ctx context.Context, query AuditQuery) (AuditPage, error) {
+	audit.repo.mu.RLock()
+	defer audit.repo.mu.RUnlock()
+
+	page := AuditPage{Entries: []model.AuditEntry{}}
+	filter := query.Filter
+	for i := len(audit.repo.audit) - 1; i >= 0; i-- {
+		entry := audit.repo.audit[i]
+		switch {
+		case filter.UserId != nil && entry.UserId != *filter.UserId:
+			continue
+		case filter.Actor != "" && entry.Actor != filter.Actor:
+			continue
+		case filter.From != nil && entry.CreatedAt.Before(*filter.From):
+			continue
+		case filter.To != nil && entry.CreatedAt.After(*filter.To):
+			continue
+		}
+
+		page.Total++
+		if page.Total > query.Offset && len(page.Entries) < query.Limit {
+			page.Entries = append(page.Entries, entry)
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,200 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"user-crud/helper"
+	"user-crud/model"
+	"user-crud/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserRepositoryEnforcesUniquenessAmongActiveUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+
+	john := model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}
+	assert.NoError(t, repo.Save(ctx, john))
+	assert.ErrorIs(t, repo.Save(ctx, john), repository.ErrDuplicateEmail)
+
+	other := john
+	other.Email = "johnny@example.com"
+	assert.ErrorIs(t, repo.Save(ctx, other), repository.ErrDuplicatePhoneNumber)
+
+	saved, err := repo.FindByEmail(ctx, john.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), saved.Version)
+	assert.NoError(t, repo.Delete(ctx, saved.Id, saved.Version))
+
+	_, err = repo.FindByEmail(ctx, john.Email)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.NoError(t, repo.Save(ctx, john), "a deleted user's email and phone number can be reused")
+	assert.ErrorIs(t, repo.Restore(ctx, saved.Id), repository.ErrRestoreConflict)
+
+	err = repo.Update(ctx, saved.Id, saved)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	purged, err := repo.Purge(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.ErrorIs(t, repo.Restore(ctx, saved.Id), repository.ErrUserNotDeleted)
+}
+
+func TestMemoryUserRepositoryUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()}))
+	john, err := repo.FindByEmail(ctx, "john.doe@example.com")
+	assert.NoError(t, err)
+
+	john.Email = "jane.doe@example.com"
+	assert.ErrorIs(t, repo.Update(ctx, john.Id, john), repository.ErrDuplicateEmail)
+
+	john.Email = "johnny@example.com"
+	assert.NoError(t, repo.Update(ctx, john.Id, john))
+
+	var conflict *repository.VersionConflictError
+	assert.ErrorAs(t, repo.Update(ctx, john.Id, john), &conflict)
+	assert.Equal(t, int64(2), conflict.Current)
+
+	_, err = repo.FindByEmail(ctx, "john.doe@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "the old email must be free again")
+
+	page, err := repo.AuditRepository().FindPage(ctx, repository.AuditQuery{Filter: repository.AuditFilter{UserId: &john.Id}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, model.AuditActionUpdate, page.Entries[0].Action)
+	assert.Equal(t, "johnny@example.com", *page.Entries[0].Changes["email"].After)
+	assert.Equal(t, repository.SystemActor, page.Entries[0].Actor)
+}
+
+func TestMemoryUserRepositorySaveAllAtomic(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+
+	users := []model.User{
+		{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()},
+		{Name: "Jane", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()},
+	}
+
+	results, err := repo.SaveAll(ctx, users, true)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, repository.ErrDuplicateEmail)
+
+	all, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, all, "an atomic batch must save nothing when a user fails")
+	audit, err := repo.AuditRepository().FindPage(ctx, repository.AuditQuery{Limit: 10})
+	assert.NoError(t, err)
+	assert.Zero(t, audit.Total)
+
+	results, err = repo.SaveAll(ctx, users, false)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, results[1].Err, repository.ErrDuplicateEmail)
+	found, err := repo.FindById(ctx, results[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", found.Name)
+}
+
+func TestMemoryUserRepositoryLoad(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+
+	id := uuid.New()
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := repo.Load([]model.User{
+		{Id: id, Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: createdAt},
+		{Name: "Jane", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000002"},
+	})
+	assert.ErrorIs(t, err, repository.ErrDuplicateEmail)
+	_, err = repo.FindById(ctx, id)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "a failed load must add nothing")
+
+	err = repo.Load([]model.User{{Id: id, Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: createdAt}})
+	assert.NoError(t, err)
+
+	user, err := repo.FindById(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, createdAt, user.CreatedAt)
+	assert.Equal(t, createdAt, user.UpdatedAt)
+	assert.Equal(t, int64(1), user.Version)
+}
+
+func TestMemoryUserRepositoryFindPageCursorsMatchOffsetPaging(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, repo.Save(ctx, model.User{
+			Name:        []string{"Ali", "Ayşe", "Elif"}[i%3],
+			Surname:     "Doe",
+			Email:       fmt.Sprintf("user%d@example.com", i),
+			PhoneNumber: fmt.Sprintf("555000000%d", i),
+			CreatedAt:   time.Now().Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	sort, err := repository.ParseSort("name,-created_at")
+	assert.NoError(t, err)
+
+	all, err := repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, all.Total)
+
+	var forward []model.User
+	query := repository.UserQuery{Sort: sort, Limit: 3}
+	for {
+		page, err := repo.FindPage(ctx, query)
+		assert.NoError(t, err)
+		forward = append(forward, page.Users...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor, err = repository.DecodeCursor(page.NextCursor)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, all.Users, forward)
+
+	page, err := repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: 3, Offset: 3})
+	assert.NoError(t, err)
+	cursor, err := repository.DecodeCursor(page.PrevCursor)
+	assert.NoError(t, err)
+	previous, err := repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: 3, Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, all.Users[:3], previous.Users)
+	assert.Empty(t, previous.PrevCursor)
+	assert.NotEmpty(t, previous.NextCursor)
+
+	cursor.Sort = "name"
+	_, err = repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: 3, Cursor: cursor})
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+}
+
+func TestMemoryUserRepositorySearch(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "Jane", Surname: "Smith", Email: "jane@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()}))
+
+	page, err := repo.Search(ctx, "jo do", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	assert.Equal(t, "<mark>John</mark>", page.Results[0].Snippet)
+
+	page, err = repo.Search(ctx, "example", repository.Page{Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, "John", page.Results[0].User.Name)
+	assert.Equal(t, "john.doe@<mark>example</mark>.com", page.Results[0].Snippet)
+
+	_, err = repo.Search(ctx, "***", repository.Page{Limit: 10})
+	assert.ErrorIs(t, err, repository.ErrInvalidSearchQuery)
+}
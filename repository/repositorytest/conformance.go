@@ -0,0 +1,688 @@
+// Package repositorytest checks that a repository.UserRepository behaves the
+// way the service layer relies on, whatever it stores users in.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"user-crud/helper"
+	"user-crud/model"
+	"user-crud/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory returns a new, empty repository for one test. Anything it opens
+// should be closed with t.Cleanup.
+type Factory func(t *testing.T) repository.UserRepository
+
+// RunConformance runs the conformance suite against the repositories made by
+// factory, each test on a fresh one.
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.UserRepository)
+	}{
+		{"SaveAndFind", testSaveAndFind},
+		{"SaveWithId", testSaveWithId},
+		{"NotFound", testNotFound},
+		{"Uniqueness", testUniqueness},
+		{"CanonicalEmails", testCanonicalEmails},
+		{"Versions", testVersions},
+		{"SoftDeleteRestoreAndPurge", testSoftDeleteRestoreAndPurge},
+		{"SaveAll", testSaveAll},
+		{"Ordering", testOrdering},
+		{"Filters", testFilters},
+		{"Search", testSearch},
+		{"SearchEscapesSnippets", testSearchEscapesSnippets},
+		{"ConcurrentSaves", testConcurrentSaves},
+		{"ConcurrentDuplicates", testConcurrentDuplicates},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, factory(t))
+		})
+	}
+}
+
+// baseTime is when the first test user was created. Whole seconds keep it
+// exact in every store.
+var baseTime = time.Date(2024, 12, 30, 12, 0, 0, 0, time.UTC)
+
+// newUser returns the i-th test user, created i minutes after baseTime.
+func newUser(i int) model.User {
+	return model.User{
+		Name:        "John",
+		Surname:     "Doe",
+		Email:       fmt.Sprintf("user%d@example.com", i),
+		PhoneNumber: fmt.Sprintf("555%07d", i),
+		CreatedAt:   baseTime.Add(time.Duration(i) * time.Minute),
+	}
+}
+
+// save saves user and returns it as stored.
+func save(t *testing.T, repo repository.UserRepository, user model.User) model.User {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := repo.Save(ctx, user); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	saved, err := repo.FindByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("Failed to find saved user: %v", err)
+	}
+	return saved
+}
+
+func ids(users []model.User) []uuid.UUID {
+	userIds := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		userIds[i] = user.Id
+	}
+	return userIds
+}
+
+func testSaveAndFind(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := save(t, repo, newUser(1))
+
+	assert.NotEqual(t, uuid.Nil, user.Id)
+	assert.Equal(t, "John", user.Name)
+	assert.Equal(t, "Doe", user.Surname)
+	assert.Equal(t, "user1@example.com", user.Email)
+	assert.Equal(t, "5550000001", user.PhoneNumber)
+	assert.True(t, user.CreatedAt.Equal(newUser(1).CreatedAt), "created_at must be kept, got %s", user.CreatedAt)
+	assert.True(t, user.UpdatedAt.Equal(user.CreatedAt), "a new user is unchanged since it was created")
+	assert.Nil(t, user.DeletedAt)
+	assert.Equal(t, int64(1), user.Version)
+
+	byId, err := repo.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, user, byId)
+
+	byPhoneNumber, err := repo.FindByPhoneNumber(ctx, user.PhoneNumber)
+	assert.NoError(t, err)
+	assert.Equal(t, user, byPhoneNumber)
+
+	users, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{user.Id}, ids(users))
+}
+
+func testSaveWithId(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	userId := uuid.New()
+
+	user := newUser(1)
+	user.Id = userId
+	saved := save(t, repo, user)
+	assert.Equal(t, userId, saved.Id)
+
+	again := newUser(2)
+	again.Id = userId
+	assert.ErrorIs(t, repo.Save(ctx, again), repository.ErrDuplicateId)
+
+	assert.NoError(t, repo.Delete(ctx, userId, saved.Version))
+	assert.ErrorIs(t, repo.Save(ctx, again), repository.ErrDuplicateId, "a deleted user keeps its id")
+	_, err := repo.FindByEmail(ctx, again.Email)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testNotFound(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	missingId := uuid.New()
+
+	users, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	_, err = repo.FindById(ctx, missingId)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.FindByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.FindByPhoneNumber(ctx, "5559999999")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	user := newUser(1)
+	user.Version = 1
+	assert.ErrorIs(t, repo.Update(ctx, missingId, user), repository.ErrNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, missingId, 1), repository.ErrNotFound)
+	assert.ErrorIs(t, repo.Restore(ctx, missingId), repository.ErrUserNotDeleted)
+}
+
+func testUniqueness(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	john := save(t, repo, newUser(1))
+	jane := save(t, repo, newUser(2))
+
+	sameEmail := newUser(3)
+	sameEmail.Email = john.Email
+	assert.ErrorIs(t, repo.Save(ctx, sameEmail), repository.ErrDuplicateEmail)
+
+	samePhoneNumber := newUser(3)
+	samePhoneNumber.PhoneNumber = john.PhoneNumber
+	assert.ErrorIs(t, repo.Save(ctx, samePhoneNumber), repository.ErrDuplicatePhoneNumber)
+
+	update := jane
+	update.Email = john.Email
+	assert.ErrorIs(t, repo.Update(ctx, jane.Id, update), repository.ErrDuplicateEmail)
+
+	update = jane
+	update.PhoneNumber = john.PhoneNumber
+	assert.ErrorIs(t, repo.Update(ctx, jane.Id, update), repository.ErrDuplicatePhoneNumber)
+
+	update = jane
+	update.Name = "Jane"
+	assert.NoError(t, repo.Update(ctx, jane.Id, update), "keeping one's own email and phone number is not a conflict")
+
+	assert.NoError(t, repo.Delete(ctx, john.Id, john.Version))
+	reused := save(t, repo, sameEmail)
+	assert.NotEqual(t, john.Id, reused.Id, "a deleted user's email can be reused")
+
+	assert.ErrorIs(t, repo.Restore(ctx, john.Id), repository.ErrRestoreConflict)
+	_, err := repo.FindById(ctx, john.Id)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "a conflicting restore must leave the user deleted")
+}
+
+// testCanonicalEmails checks the rules every repository applies; the
+// provider-specific ones are off in the repositories under test.
+func testCanonicalEmails(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	user := newUser(1)
+	user.Email = "John.Doe@Example.COM"
+	john := save(t, repo, user)
+	assert.Equal(t, "John.Doe@Example.COM", john.Email, "the email is stored as given")
+
+	found, err := repo.FindByEmail(ctx, "john.doe@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, john.Id, found.Id)
+
+	sameMailbox := newUser(2)
+	sameMailbox.Email = "JOHN.DOE@example.com"
+	assert.ErrorIs(t, repo.Save(ctx, sameMailbox), repository.ErrDuplicateEmail)
+
+	jane := save(t, repo, newUser(3))
+	update := jane
+	update.Email = "john.doe@EXAMPLE.com"
+	assert.ErrorIs(t, repo.Update(ctx, jane.Id, update), repository.ErrDuplicateEmail)
+
+	plusTag := newUser(4)
+	plusTag.Email = "john.doe+work@example.com"
+	save(t, repo, plusTag)
+
+	idn := newUser(5)
+	idn.Email = "user@Bücher.example"
+	save(t, repo, idn)
+	found, err = repo.FindByEmail(ctx, "user@xn--bcher-kva.example")
+	assert.NoError(t, err)
+	assert.Equal(t, "user@Bücher.example", found.Email)
+
+	invalid := newUser(6)
+	invalid.Email = "nobody"
+	assert.ErrorIs(t, repo.Save(ctx, invalid), helper.ErrInvalidEmail)
+	_, err = repo.FindByEmail(ctx, "nobody")
+	assert.ErrorIs(t, err, helper.ErrInvalidEmail)
+	assert.NotErrorIs(t, err, repository.ErrNotFound, "an invalid email is not a missing user")
+}
+
+func testVersions(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := save(t, repo, newUser(1))
+
+	update := user
+	update.Name = "Johnny"
+	assert.NoError(t, repo.Update(ctx, user.Id, update))
+
+	updated, err := repo.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Johnny", updated.Name)
+	assert.Equal(t, int64(2), updated.Version)
+	assert.True(t, updated.UpdatedAt.After(user.UpdatedAt), "updated_at must move forward")
+	assert.True(t, updated.CreatedAt.Equal(user.CreatedAt), "created_at must not change")
+
+	var conflict *repository.VersionConflictError
+	assert.ErrorAs(t, repo.Update(ctx, user.Id, update), &conflict)
+	if conflict != nil {
+		assert.Equal(t, repository.VersionConflictError{UserId: user.Id, Expected: 1, Current: 2}, *conflict)
+	}
+
+	conflict = nil
+	assert.ErrorAs(t, repo.Delete(ctx, user.Id, 1), &conflict)
+	if conflict != nil {
+		assert.Equal(t, int64(2), conflict.Current)
+	}
+
+	current, err := repo.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, updated, current, "rejected writes must not change the user")
+}
+
+func testSoftDeleteRestoreAndPurge(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := save(t, repo, newUser(1))
+	other := save(t, repo, newUser(2))
+
+	assert.NoError(t, repo.Delete(ctx, user.Id, user.Version))
+	assert.ErrorIs(t, repo.Delete(ctx, user.Id, user.Version+1), repository.ErrNotFound, "a deleted user cannot be deleted again")
+
+	_, err := repo.FindById(ctx, user.Id)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.FindByEmail(ctx, user.Email)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	users, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{other.Id}, ids(users))
+
+	page, err := repo.FindPage(ctx, repository.UserQuery{Filter: repository.UserFilter{IncludeDeleted: true}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, []uuid.UUID{user.Id, other.Id}, ids(page.Users))
+	if assert.NotNil(t, page.Users[0].DeletedAt) {
+		assert.WithinDuration(t, time.Now(), *page.Users[0].DeletedAt, time.Minute)
+	}
+	assert.Equal(t, int64(2), page.Users[0].Version)
+
+	assert.NoError(t, repo.Restore(ctx, user.Id))
+	assert.ErrorIs(t, repo.Restore(ctx, user.Id), repository.ErrUserNotDeleted)
+
+	restored, err := repo.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+
+	assert.NoError(t, repo.Delete(ctx, user.Id, restored.Version))
+
+	purged, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, purged, "users deleted after deletedBefore must be kept")
+
+	purged, err = repo.Purge(ctx, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.ErrorIs(t, repo.Restore(ctx, user.Id), repository.ErrUserNotDeleted)
+
+	_, err = repo.FindById(ctx, other.Id)
+	assert.NoError(t, err, "purging must not touch active users")
+}
+
+func testSaveAll(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	duplicate := newUser(3)
+	duplicate.Email = newUser(1).Email
+	users := []model.User{newUser(1), newUser(2), duplicate}
+
+	results, err := repo.SaveAll(ctx, users, true)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[2].Err, repository.ErrDuplicateEmail)
+
+	saved, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, saved, "an atomic batch must save nothing when a user fails")
+
+	results, err = repo.SaveAll(ctx, users, false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.ErrorIs(t, results[2].Err, repository.ErrDuplicateEmail)
+
+	for i, result := range results[:2] {
+		user, err := repo.FindById(ctx, result.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, users[i].Email, user.Email)
+	}
+}
+
+func testOrdering(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	names := []string{"Ada", "Bob", "Ada", "Cem", "Bob", "Ada", "Dan"}
+	var saved []model.User
+	for i, name := range names {
+		user := newUser(i)
+		user.Name = name
+		// Repeat creation times so the id has to break ties.
+		user.CreatedAt = baseTime.Add(time.Duration(i%3) * time.Hour)
+		saved = append(saved, save(t, repo, user))
+	}
+
+	var exported []model.User
+	err := repo.Export(ctx, repository.UserFilter{}, func(user model.User) error {
+		exported = append(exported, user)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, isSorted(exported, "created_at"), "export must list the oldest users first")
+	assert.ElementsMatch(t, ids(saved), ids(exported))
+
+	for _, sort := range []string{"created_at", "name,-created_at", "-email", "surname,name"} {
+		t.Run(sort, func(t *testing.T) {
+			fields, err := repository.ParseSort(sort)
+			assert.NoError(t, err)
+
+			all, err := repo.FindPage(ctx, repository.UserQuery{Sort: fields, Limit: len(names)})
+			assert.NoError(t, err)
+			assert.Equal(t, len(names), all.Total)
+			assert.Len(t, all.Users, len(names))
+			assert.True(t, isSorted(all.Users, sort), "users must be sorted by %s", sort)
+			assert.Empty(t, all.NextCursor)
+			assert.Empty(t, all.PrevCursor)
+
+			var forward []model.User
+			query := repository.UserQuery{Sort: fields, Limit: 3}
+			var last repository.UserPage
+			for pages := 0; pages < len(names); pages++ {
+				last, err = repo.FindPage(ctx, query)
+				assert.NoError(t, err)
+				forward = append(forward, last.Users...)
+				if last.NextCursor == "" {
+					break
+				}
+				query.Cursor, err = repository.DecodeCursor(last.NextCursor)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, ids(all.Users), ids(forward), "cursor paging must list every user once")
+
+			query.Cursor, err = repository.DecodeCursor(last.PrevCursor)
+			assert.NoError(t, err)
+			previous, err := repo.FindPage(ctx, query)
+			assert.NoError(t, err)
+			assert.Equal(t, ids(all.Users[3:6]), ids(previous.Users))
+			assert.NotEmpty(t, previous.NextCursor)
+			assert.NotEmpty(t, previous.PrevCursor)
+
+			offset, err := repo.FindPage(ctx, repository.UserQuery{Sort: fields, Limit: 3, Offset: 3})
+			assert.NoError(t, err)
+			assert.Equal(t, ids(all.Users[3:6]), ids(offset.Users))
+			assert.NotEmpty(t, offset.NextCursor)
+			assert.NotEmpty(t, offset.PrevCursor)
+		})
+	}
+
+	fields, _ := repository.ParseSort("name")
+	otherFields, _ := repository.ParseSort("email")
+	page, err := repo.FindPage(ctx, repository.UserQuery{Sort: fields, Limit: 3})
+	assert.NoError(t, err)
+	cursor, err := repository.DecodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	_, err = repo.FindPage(ctx, repository.UserQuery{Sort: otherFields, Limit: 3, Cursor: cursor})
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+}
+
+// isSorted reports whether users are in the order given by sort, with ties
+// broken by id.
+func isSorted(users []model.User, sort string) bool {
+	fields, err := repository.ParseSort(sort)
+	if err != nil {
+		return false
+	}
+
+	for i := 1; i < len(users); i++ {
+		if compare(fields, users[i-1], users[i]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func compare(fields []repository.SortField, a, b model.User) int {
+	for _, field := range fields {
+		var result int
+		switch field.Field {
+		case "name":
+			result = compareStrings(a.Name, b.Name)
+		case "surname":
+			result = compareStrings(a.Surname, b.Surname)
+		case "email":
+			result = compareStrings(a.Email, b.Email)
+		case "created_at":
+			result = a.CreatedAt.Compare(b.CreatedAt)
+		case "updated_at":
+			result = a.UpdatedAt.Compare(b.UpdatedAt)
+		}
+		if field.Desc {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return compareStrings(a.Id.String(), b.Id.String())
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func testFilters(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	users := []model.User{newUser(0), newUser(1), newUser(2), newUser(3)}
+	users[1].Name = "Jane"
+	users[2].Email = "jane@Company.com"
+	users[3].Surname = "Smith"
+	var saved []model.User
+	for _, user := range users {
+		saved = append(saved, save(t, repo, user))
+	}
+	assert.NoError(t, repo.Delete(ctx, saved[0].Id, saved[0].Version))
+
+	createdFrom, createdTo := baseTime.Add(time.Minute), baseTime.Add(2*time.Minute)
+	tests := []struct {
+		name   string
+		filter repository.UserFilter
+		want   []uuid.UUID
+	}{
+		{"none", repository.UserFilter{}, ids(saved[1:])},
+		{"deleted", repository.UserFilter{IncludeDeleted: true}, ids(saved)},
+		{"name ignores case", repository.UserFilter{Name: "JANE"}, ids(saved[1:2])},
+		{"surname", repository.UserFilter{Surname: "smith"}, ids(saved[3:])},
+		{"email domain", repository.UserFilter{EmailDomain: "company.com"}, ids(saved[2:3])},
+		{"created range", repository.UserFilter{CreatedFrom: &createdFrom, CreatedTo: &createdTo}, ids(saved[1:3])},
+		{"updated since", repository.UserFilter{UpdatedSince: &createdTo}, ids(saved[2:])},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := repo.FindPage(ctx, repository.UserQuery{Filter: test.filter, Limit: 10})
+			assert.NoError(t, err)
+			assert.Equal(t, len(test.want), page.Total)
+			assert.Equal(t, test.want, ids(page.Users))
+
+			var exported []uuid.UUID
+			err = repo.Export(ctx, test.filter, func(user model.User) error {
+				exported = append(exported, user.Id)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, exported)
+		})
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.Export(ctx, repository.UserFilter{}, func(user model.User) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls, "export must stop at the first error")
+}
+
+func testSearch(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	users := []model.User{
+		{Name: "Elif", Surname: "Çelik", Email: "elif.celik@example.com", PhoneNumber: "5550000001"},
+		{Name: "Celal", Surname: "Yılmaz", Email: "celal@example.com", PhoneNumber: "5550000002"},
+		{Name: "John", Surname: "Doe", Email: "johndoe@celikmail.com", PhoneNumber: "5550000003"},
+		{Name: "Jane", Surname: "Smith", Email: "jane@example.com", PhoneNumber: "5550000004"},
+		{Name: "Celil", Surname: "Deleted", Email: "celil@example.com", PhoneNumber: "5550000005"},
+	}
+	for _, user := range users {
+		user.CreatedAt = baseTime
+		save(t, repo, user)
+	}
+	deleted, err := repo.FindByEmail(ctx, "celil@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Delete(ctx, deleted.Id, deleted.Version))
+
+	page, err := repo.Search(ctx, "cel", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total, "matching must ignore case and diacritics and skip deleted users")
+	assert.Len(t, page.Results, 3)
+	for _, result := range page.Results {
+		assert.Contains(t, result.Snippet, repository.SnippetStart)
+		assert.Contains(t, result.Snippet, repository.SnippetEnd)
+	}
+
+	page, err = repo.Search(ctx, "ELIF cel", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.Total, "every word must match")
+	if assert.Len(t, page.Results, 1) {
+		assert.Equal(t, "Elif", page.Results[0].User.Name)
+	}
+
+	page, err = repo.Search(ctx, "cel", repository.Page{Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Results, 1)
+
+	page, err = repo.Search(ctx, "elik", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Zero(t, page.Total, "words must match from their start")
+
+	page, err = repo.Search(ctx, `name:"OR" NOT`, repository.Page{Limit: 10})
+	assert.NoError(t, err, "query syntax in user input should be treated as words")
+	assert.Zero(t, page.Total)
+
+	_, err = repo.Search(ctx, "  @!  ", repository.Page{Limit: 10})
+	assert.ErrorIs(t, err, repository.ErrInvalidSearchQuery)
+}
+
+// concurrency is how many goroutines the concurrency tests run at once.
+const concurrency = 16
+
+// parallel runs fn concurrently for 0 to concurrency-1 and returns the
+// errors in that order.
+// testSearchEscapesSnippets checks that snippets, which are HTML, escape the
+// text users typed.
+func testSearchEscapesSnippets(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	user := newUser(1)
+	user.Name = "<script>alert(1)</script>"
+	save(t, repo, user)
+
+	page, err := repo.Search(ctx, "script", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Results, 1) {
+		assert.Equal(t, "&lt;<mark>script</mark>&gt;alert(1)&lt;/<mark>script</mark>&gt;", page.Results[0].Snippet)
+	}
+}
+
+func parallel(fn func(i int) error) []error {
+	errs := make([]error, concurrency)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+func testConcurrentSaves(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	errs := parallel(func(i int) error {
+		return repo.Save(ctx, newUser(i))
+	})
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	users, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, concurrency)
+}
+
+func testConcurrentDuplicates(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	errs := parallel(func(i int) error {
+		user := newUser(i)
+		user.Email = "taken@example.com"
+		return repo.Save(ctx, user)
+	})
+
+	saved := 0
+	for _, err := range errs {
+		if err == nil {
+			saved++
+			continue
+		}
+		assert.ErrorIs(t, err, repository.ErrDuplicateEmail)
+	}
+	assert.Equal(t, 1, saved, "only one of the concurrent saves may take the email")
+
+	users, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func testConcurrentUpdates(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := save(t, repo, newUser(1))
+
+	errs := parallel(func(i int) error {
+		update := user
+		update.Name = fmt.Sprintf("John %d", i)
+		return repo.Update(ctx, user.Id, update)
+	})
+
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			assert.Equal(t, -1, winner, "only one update of version 1 may succeed")
+			winner = i
+			continue
+		}
+		var conflict *repository.VersionConflictError
+		assert.ErrorAs(t, err, &conflict)
+	}
+
+	updated, err := repo.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+	if assert.NotEqual(t, -1, winner) {
+		assert.Equal(t, fmt.Sprintf("John %d", winner), updated.Name)
+	}
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"user-crud/model"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// sortColumns whitelists the fields that can be used in a sort expression
+// and maps them to their column. Users are always tie-broken by id.
+var sortColumns = map[string]string{
+	"name":       "name",
+	"surname":    "surname",
+	"email":      "email",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+const DefaultSort = "created_at"
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type UserFilter struct {
+	Name        string
+	Surname     string
+	EmailDomain string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	// UpdatedSince only lists users changed at or after this time.
+	UpdatedSince *time.Time
+
+	// IncludeDeleted also lists users that were soft-deleted but not yet
+	// purged.
+	IncludeDeleted bool
+}
+
+type UserQuery struct {
+	Filter UserFilter
+	Sort   []SortField
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+type UserPage struct {
+	Users      []model.User
+	Total      int
+	NextCursor string
+	PrevCursor string
+}
+
+// ParseSort parses a comma separated list of sortable fields, each
+// optionally prefixed with "-" for descending or "+" for ascending order.
+func ParseSort(value string) ([]SortField, error) {
+	if strings.TrimSpace(value) == "" {
+		value = DefaultSort
+	}
+
+	seen := map[string]bool{}
+	var fields []SortField
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimLeft(part, "+-"), Desc: strings.HasPrefix(part, "-")}
+
+		if _, ok := sortColumns[field.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q, expected one of %s", ErrInvalidSort, field.Field, strings.Join(SortableFields(), ", "))
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("%w: field %q is listed twice", ErrInvalidSort, field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func SortableFields() []string {
+	fields := make([]string, 0, len(sortColumns))
+	for field := range sortColumns {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func formatSort(fields []SortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Field
+		if field.Desc {
+			parts[i] = "-" + field.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Cursor points just past (or, with Before, just before) a row in a sorted
+// listing. Values hold the row's sort keys as stored in the database.
+type Cursor struct {
+	Before bool     `json:"b,omitempty"`
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	Id     string   `json:"i"`
+}
+
+func EncodeCursor(cursor Cursor) string {
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil || cursor.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// filterConditions builds the WHERE conditions for filter. Only fixed column
+// names are written into the SQL; every value is passed as an argument.
+func filterConditions(filter UserFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if filter.Name != "" {
+		conditions = append(conditions, "name = ? COLLATE NOCASE")
+		args = append(args, filter.Name)
+	}
+	if filter.Surname != "" {
+		conditions = append(conditions, "surname = ? COLLATE NOCASE")
+		args = append(args, filter.Surname)
+	}
+	if filter.EmailDomain != "" {
+		conditions = append(conditions, "LOWER(email) LIKE ? ESCAPE '\\'")
+		args = append(args, "%@"+escapeLike(strings.ToLower(filter.EmailDomain)))
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC())
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.CreatedTo.UTC())
+	}
+	if filter.UpdatedSince != nil {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, filter.UpdatedSince.UTC())
+	}
+
+	return conditions, args
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+// checkCursor reports whether cursor was issued for a listing sorted by
+// fields.
+func checkCursor(fields []SortField, cursor *Cursor) error {
+	if cursor.Sort != formatSort(fields) || len(cursor.Values) != len(fields) {
+		return fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidCursor)
+	}
+	return nil
+}
+
+// keysetCondition selects the rows after the cursor in the order given by
+// fields (or before it when the cursor points backwards), using id as the
+// final tie-breaker.
+func keysetCondition(fields []SortField, cursor *Cursor) (string, []interface{}, error) {
+	if err := checkCursor(fields, cursor); err != nil {
+		return "", nil, err
+	}
+
+	columns := make([]string, 0, len(fields)+1)
+	descending := make([]bool, 0, len(fields)+1)
+	values := make([]interface{}, 0, len(fields)+1)
+	for i, field := range fields {
+		columns = append(columns, sortColumns[field.Field])
+		descending = append(descending, field.Desc)
+		values = append(values, cursor.Values[i])
+	}
+	columns = append(columns, "id")
+	descending = append(descending, false)
+	values = append(values, cursor.Id)
+
+	var clauses []string
+	var args []interface{}
+	for i := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+
+		operator := ">"
+		if descending[i] != cursor.Before {
+			operator = "<"
+		}
+		parts = append(parts, columns[i]+" "+operator+" ?")
+		args = append(args, values[i])
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")", args, nil
+}
+
+func orderByClause(fields []SortField, reverse bool) string {
+	parts := make([]string, 0, len(fields)+1)
+	for _, field := range fields {
+		direction := "ASC"
+		if field.Desc != reverse {
+			direction = "DESC"
+		}
+		parts = append(parts, sortColumns[field.Field]+" "+direction)
+	}
+
+	if reverse {
+		parts = append(parts, "id DESC")
+	} else {
+		parts = append(parts, "id ASC")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// rawTimestamps holds a user's timestamps exactly as stored, so that keyset
+// comparisons against them match.
+type rawTimestamps struct {
+	CreatedAt string
+	UpdatedAt string
+}
+
+// cursorFor returns a cursor positioned at user.
+func cursorFor(fields []SortField, user model.User, raw rawTimestamps, before bool) string {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		switch field.Field {
+		case "name":
+			values[i] = user.Name
+		case "surname":
+			values[i] = user.Surname
+		case "email":
+			values[i] = user.Email
+		case "created_at":
+			values[i] = raw.CreatedAt
+		case "updated_at":
+			values[i] = raw.UpdatedAt
+		}
+	}
+
+	return EncodeCursor(Cursor{
+		Before: before,
+		Sort:   formatSort(fields),
+		Values: values,
+		Id:     user.Id.String(),
+	})
+}
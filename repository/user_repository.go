@@ -2,17 +2,73 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 	"user-crud/model"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrNotFound is returned when there is no active user to read or
+	// change.
+	ErrNotFound = errors.New("user not found")
+
+	ErrShuttingDown    = errors.New("repository is shutting down")
+	ErrUserNotDeleted  = errors.New("no deleted user with this id")
+	ErrRestoreConflict = errors.New("an active user has the same email or phone number")
+
+	ErrDuplicateId          = errors.New("a user with this id already exists")
+	ErrDuplicateEmail       = errors.New("a user with this email already exists")
+	ErrDuplicatePhoneNumber = errors.New("a user with this phone number already exists")
+)
+
+// EmailCanonicalizer is implemented by repositories that tell emails apart by
+// their canonical form; see helper.CanonicalEmail. Saving, updating or
+// finding a user by an email that has no canonical form fails with
+// helper.ErrInvalidEmail.
+type EmailCanonicalizer interface {
+	CanonicalEmail(email string) (string, error)
+}
+
+// VersionConflictError is returned by conditional writes when the user is no
+// longer at the version the caller read.
+type VersionConflictError struct {
+	UserId   uuid.UUID
+	Expected int64
+	Current  int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("user %s is at version %d, expected %d", e.UserId, e.Current, e.Expected)
+}
+
+// SaveResult is the outcome of saving one user of a batch: the id it was
+// created with, or why it was not saved.
+type SaveResult struct {
+	Id  uuid.UUID
+	Err error
+}
+
 type UserRepository interface {
 	Save(ctx context.Context, user model.User) error 
+	SaveAll(ctx context.Context, users []model.User, atomic bool) ([]SaveResult, error)
 	Update(ctx context.Context, userId uuid.UUID, user model.User) error
-	Delete(ctx context.Context, userId uuid.UUID) error
+	Delete(ctx context.Context, userId uuid.UUID, version int64) error
+	Restore(ctx context.Context, userId uuid.UUID) error
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
 	FindById(ctx context.Context, userId uuid.UUID) (model.User, error)
 	FindByEmail(ctx context.Context, email string) (model.User, error)
 	FindByPhoneNumber(ctx context.Context, phoneNumber string) (model.User, error)
 	FindAll(ctx context.Context) ([]model.User, error)
-}
\ No newline at end of file
+	FindPage(ctx context.Context, query UserQuery) (UserPage, error)
+	Search(ctx context.Context, query string, page Page) (SearchPage, error)
+	Export(ctx context.Context, filter UserFilter, fn func(user model.User) error) error
+}
+
+// Drainer is implemented by repositories that track in-flight work and can
+// wait for it to finish during shutdown.
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
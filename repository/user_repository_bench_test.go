@@ -0,0 +1,102 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+	"user-crud/helper"
+	"user-crud/model"
+
+	"github.com/google/uuid"
+)
+
+// benchmarkUsers is how many users the benchmark database holds.
+const benchmarkUsers = 1000
+
+// openBenchmarkDB opens a SQLite file with the server's default settings and
+// fills it with users.
+func openBenchmarkDB(b *testing.B) (*sql.DB, []model.User) {
+	db := openConfiguredDB(b)
+
+	users := make([]model.User, benchmarkUsers)
+	for i := range users {
+		users[i] = model.User{
+			Name:        "John",
+			Surname:     "Doe",
+			Email:       fmt.Sprintf("john.doe.%d@example.com", i),
+			PhoneNumber: fmt.Sprintf("555%07d", i),
+			CreatedAt:   time.Now(),
+		}
+	}
+
+	repo := newRepository(b, db)
+	results, err := repo.SaveAll(context.Background(), users, true)
+	if err != nil {
+		b.Fatalf("Failed to save users: %v", err)
+	}
+	for i, result := range results {
+		users[i].Id = result.Id
+	}
+
+	return db, users
+}
+
+// findByIdInTx reads a user the way the repository did before its reads were
+// prepared: in a transaction, parsing the SQL every time.
+func findByIdInTx(ctx context.Context, db *sql.DB, userId uuid.UUID) (model.User, error) {
+	user := model.User{}
+	err := helper.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		SQL := "SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE id = ? AND deleted_at IS NULL"
+		return tx.QueryRowContext(ctx, SQL, userId).Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt, &user.UpdatedAt, &user.Version)
+	})
+	return user, err
+}
+
+func BenchmarkFindById(b *testing.B) {
+	db, users := openBenchmarkDB(b)
+	repo := newRepository(b, db)
+	ctx := context.Background()
+
+	finders := []struct {
+		name string
+		find func(userId uuid.UUID) (model.User, error)
+	}{
+		{"transaction", func(userId uuid.UUID) (model.User, error) { return findByIdInTx(ctx, db, userId) }},
+		{"prepared", func(userId uuid.UUID) (model.User, error) { return repo.FindById(ctx, userId) }},
+	}
+
+	for _, finder := range finders {
+		b.Run(finder.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := finder.find(users[i%len(users)].Id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(finder.name+"-parallel", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := finder.find(users[i%len(users)].Id); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkFindByEmail(b *testing.B) {
+	db, users := openBenchmarkDB(b)
+	repo := newRepository(b, db)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.FindByEmail(ctx, users[i%len(users)].Email); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -3,163 +3,454 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 	"user-crud/helper"
 	"user-crud/model"
 
 	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
 )
 
 type UserRepositoryImpl struct {
 	Db *sql.DB
+
+	emailRules helper.EmailRules
+
+	findByIdStmt          *sql.Stmt
+	findByEmailStmt       *sql.Stmt
+	findByPhoneNumberStmt *sql.Stmt
+	findAllStmt           *sql.Stmt
+
+	mu       sync.RWMutex
+	draining bool
+	inflight sync.WaitGroup
 }
 
-func NewUserRepository(db *sql.DB) UserRepository {
-	return &UserRepositoryImpl{Db: db}
+// NewUserRepository prepares the statements the repository reads with. They
+// stay open until Close. Emails are unique and looked up by their canonical
+// form under emailRules, which must be the rules the database was migrated
+// with.
+func NewUserRepository(db *sql.DB, emailRules helper.EmailRules) (UserRepository, error) {
+	repo := &UserRepositoryImpl{Db: db, emailRules: emailRules}
+
+	statements := []struct {
+		stmt **sql.Stmt
+		SQL  string
+	}{
+		{&repo.findByIdStmt, "SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE id = ? AND deleted_at IS NULL"},
+		{&repo.findByEmailStmt, "SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE email_canonical = ? AND deleted_at IS NULL"},
+		{&repo.findByPhoneNumberStmt, "SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE phone_number = ? AND deleted_at IS NULL"},
+		{&repo.findAllStmt, "SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE deleted_at IS NULL"},
+	}
+	for _, statement := range statements {
+		stmt, err := db.Prepare(statement.SQL)
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		*statement.stmt = stmt
+	}
+
+	return repo, nil
 }
 
-func (repo *UserRepositoryImpl) Save(ctx context.Context, user model.User) error {
-	user.Id = uuid.New()
+// Close closes the prepared statements. It should be called after Drain,
+// once nothing uses the repository any more.
+func (repo *UserRepositoryImpl) Close() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{repo.findByIdStmt, repo.findByEmailStmt, repo.findByPhoneNumberStmt, repo.findAllStmt} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
 
-	tx, err := repo.Db.Begin()
+// withTx runs fn in a transaction that Drain will wait for.
+func (repo *UserRepositoryImpl) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	done, err := repo.track()
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
+		return err
 	}
+	defer done()
 
-	defer helper.CommitOrRollback(tx)
+	return helper.WithTx(ctx, repo.Db, nil, fn)
+}
 
-	SQL := "INSERT INTO users (id, name, surname, email, phone_number, created_at) VALUES (?, ?, ?, ?, ?, ?)"
-	_, err = tx.Exec(SQL, user.Id, user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt)
+// read runs fn, which reads with db outside a transaction, as work that Drain
+// will wait for. Transactions take the write lock at BEGIN with the default
+// tx_lock, so reads that ran in one would queue behind writers and block
+// them; outside one they see the last commit, as WAL allows.
+func (repo *UserRepositoryImpl) read(ctx context.Context, fn func(db *sql.DB) error) error {
+	done, err := repo.track()
 	if err != nil {
-		return fmt.Errorf("failed to execute insert query: %v", err)
+		return err
 	}
-	return nil
+	defer done()
+
+	return fn(repo.Db)
 }
 
-func (repo *UserRepositoryImpl) Update(ctx context.Context, userId uuid.UUID, user model.User) error {
-	tx, err := repo.Db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
+// track registers work that Drain will wait for. The returned function must
+// be called when the work is finished.
+func (repo *UserRepositoryImpl) track() (func(), error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if repo.draining {
+		return nil, ErrShuttingDown
+	}
+	repo.inflight.Add(1)
+
+	return repo.inflight.Done, nil
+}
+
+// Drain stops new transactions and reads from starting and waits for the
+// in-flight ones to finish or for ctx to expire.
+func (repo *UserRepositoryImpl) Drain(ctx context.Context) error {
+	repo.mu.Lock()
+	repo.draining = true
+	repo.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		repo.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight transactions did not finish: %w", ctx.Err())
 	}
+}
 
-	defer helper.CommitOrRollback(tx)
+// Save inserts user under user.Id, or under a new id when it is not set. It
+// returns ErrDuplicateId when a user, deleted or not, already has the id.
+func (repo *UserRepositoryImpl) Save(ctx context.Context, user model.User) error {
+	if user.Id == uuid.Nil {
+		user.Id = uuid.New()
+	}
 
-	SQL := "UPDATE users SET name = ?, surname = ?, email = ?, phone_number = ? WHERE id = ?"
-	_, err = tx.Exec(SQL, user.Name, user.Surname, user.Email, user.PhoneNumber, userId)
+	canonicalEmail, err := repo.CanonicalEmail(user.Email)
 	if err != nil {
-		return fmt.Errorf("failed to execute update query: %v", err)
+		return err
 	}
 
-	return nil
+	return repo.withTx(ctx, func(tx *sql.Tx) error {
+		return insertUser(ctx, tx, user, canonicalEmail)
+	})
 }
 
-func (repo *UserRepositoryImpl) Delete(ctx context.Context, userId uuid.UUID) error {
-	tx, err := repo.Db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
+// errBatchRolledBack makes withTx roll back an atomic batch in which some
+// users could not be saved.
+var errBatchRolledBack = errors.New("batch rolled back")
+
+// SaveAll saves users in one transaction and reports the outcome for each of
+// them in order. Every user is inserted under its own savepoint, so a failed
+// insert is undone without affecting the others. With atomic, nothing is
+// saved unless every user can be. The returned error is only set when the
+// batch as a whole failed.
+func (repo *UserRepositoryImpl) SaveAll(ctx context.Context, users []model.User, atomic bool) ([]SaveResult, error) {
+	results := make([]SaveResult, len(users))
+
+	err := repo.withTx(ctx, func(tx *sql.Tx) error {
+		failed := false
+		for i, user := range users {
+			if user.Id == uuid.Nil {
+				user.Id = uuid.New()
+			}
+
+			canonicalEmail, err := repo.CanonicalEmail(user.Email)
+			if err != nil {
+				results[i] = SaveResult{Id: user.Id, Err: err}
+				failed = true
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT save_user"); err != nil {
+				return fmt.Errorf("failed to create savepoint: %w", err)
+			}
+
+			err = insertUser(ctx, tx, user, canonicalEmail)
+			if err != nil {
+				if _, errRollback := tx.ExecContext(ctx, "ROLLBACK TO save_user"); errRollback != nil {
+					return fmt.Errorf("failed to roll back to savepoint: %w", errRollback)
+				}
+				if ctx.Err() != nil {
+					return err
+				}
+				failed = true
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE save_user"); err != nil {
+				return fmt.Errorf("failed to release savepoint: %w", err)
+			}
+
+			results[i] = SaveResult{Id: user.Id, Err: err}
+		}
+
+		if atomic && failed {
+			return errBatchRolledBack
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchRolledBack) {
+		return nil, err
 	}
 
-	defer helper.CommitOrRollback(tx)
+	return results, nil
+}
 
-	SQL := "DELETE FROM users WHERE id = ?"
-	_, err = tx.Exec(SQL, userId)
+// insertUser inserts user and records its creation in the audit log. A
+// conflict with an existing user is reported as ErrDuplicateEmail or
+// ErrDuplicatePhoneNumber.
+func insertUser(ctx context.Context, tx *sql.Tx, user model.User, canonicalEmail string) error {
+	SQL := "INSERT INTO users (id, name, surname, email, email_canonical, phone_number, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := tx.ExecContext(ctx, SQL, user.Id, user.Name, user.Surname, user.Email, canonicalEmail, user.PhoneNumber, user.CreatedAt.UTC(), user.CreatedAt.UTC())
+	if err := uniqueViolation(err); err != nil {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to execute delete query: %v", err)
+		return fmt.Errorf("failed to execute insert query: %w", err)
 	}
+	return writeAudit(ctx, tx, model.AuditActionCreate, user.Id, diffUsers(nil, &user))
+}
 
-	return nil
+// uniqueViolation returns ErrDuplicateId, ErrDuplicateEmail or
+// ErrDuplicatePhoneNumber when err is caused by the key or unique index on
+// that column, and nil otherwise.
+func uniqueViolation(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || (sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique && sqliteErr.ExtendedCode != sqlite3.ErrConstraintPrimaryKey) {
+		return nil
+	}
+
+	switch {
+	case strings.Contains(sqliteErr.Error(), "users.id"):
+		return fmt.Errorf("%w: %v", ErrDuplicateId, err)
+	case strings.Contains(sqliteErr.Error(), "users.email"):
+		return fmt.Errorf("%w: %v", ErrDuplicateEmail, err)
+	case strings.Contains(sqliteErr.Error(), "users.phone_number"):
+		return fmt.Errorf("%w: %v", ErrDuplicatePhoneNumber, err)
+	default:
+		return nil
+	}
 }
 
-func (repo *UserRepositoryImpl) FindById(ctx context.Context, userId uuid.UUID) (model.User, error) {
-	tx, err := repo.Db.Begin()
+// Update saves user if it is still at user.Version and increments the
+// version. It returns ErrNotFound when there is no such user, a
+// *VersionConflictError when the user was changed in the meantime, and
+// ErrDuplicateEmail or ErrDuplicatePhoneNumber when another user has the new
+// email or phone number.
+func (repo *UserRepositoryImpl) Update(ctx context.Context, userId uuid.UUID, user model.User) error {
+	canonicalEmail, err := repo.CanonicalEmail(user.Email)
 	if err != nil {
-		return model.User{}, fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
 
-	defer helper.CommitOrRollback(tx)
+	return repo.withTx(ctx, func(tx *sql.Tx) error {
+		before := model.User{}
+		SQL := "SELECT name, surname, email, phone_number FROM users WHERE id = ? AND deleted_at IS NULL"
+		err := tx.QueryRowContext(ctx, SQL, userId).Scan(&before.Name, &before.Surname, &before.Email, &before.PhoneNumber)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrNotFound, userId)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read user before update: %w", err)
+		}
 
-	SQL := "SELECT id, name, surname, email, phone_number, created_at FROM users WHERE id = ?"
-	result, err := tx.QueryContext(ctx, SQL, userId)
+		SQL = "UPDATE users SET name = ?, surname = ?, email = ?, email_canonical = ?, phone_number = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ? AND deleted_at IS NULL"
+		result, err := tx.ExecContext(ctx, SQL, user.Name, user.Surname, user.Email, canonicalEmail, user.PhoneNumber, time.Now().UTC(), userId, user.Version)
+		if err := uniqueViolation(err); err != nil {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to execute update query: %w", err)
+		}
+		if err := checkVersion(ctx, tx, result, userId, user.Version); err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, model.AuditActionUpdate, userId, diffUsers(&before, &user))
+	})
+}
+
+// Delete soft-deletes the user if it is still at version. It returns
+// ErrNotFound when there is no such user and a *VersionConflictError when the
+// user was changed in the meantime.
+func (repo *UserRepositoryImpl) Delete(ctx context.Context, userId uuid.UUID, version int64) error {
+	return repo.withTx(ctx, func(tx *sql.Tx) error {
+		deletedAt := time.Now().UTC()
+		SQL := "UPDATE users SET deleted_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ? AND deleted_at IS NULL"
+		result, err := tx.ExecContext(ctx, SQL, deletedAt, deletedAt, userId, version)
+		if err != nil {
+			return fmt.Errorf("failed to execute delete query: %w", err)
+		}
+		if err := checkVersion(ctx, tx, result, userId, version); err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, model.AuditActionDelete, userId, deletedAtChange(nil, &deletedAt))
+	})
+}
+
+// checkVersion reports why a conditional write matched no rows: the user is
+// either gone or at a different version than expected.
+func checkVersion(ctx context.Context, tx *sql.Tx, result sql.Result, userId uuid.UUID, expected int64) error {
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return model.User{}, fmt.Errorf("failed to execute query to find user by id: %w", err)
+		return fmt.Errorf("failed to check updated rows: %w", err)
+	}
+	if affected > 0 {
+		return nil
 	}
-	defer result.Close()
 
-	user := model.User{}
+	var current int64
+	SQL := "SELECT version FROM users WHERE id = ? AND deleted_at IS NULL"
+	err = tx.QueryRowContext(ctx, SQL, userId).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrNotFound, userId)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read current version: %w", err)
+	}
+
+	return &VersionConflictError{UserId: userId, Expected: expected, Current: current}
+}
 
-	if result.Next() {
-		err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt)
+// Restore undoes Delete. It fails with ErrUserNotDeleted when there is no
+// deleted user with userId, including when it has already been purged.
+func (repo *UserRepositoryImpl) Restore(ctx context.Context, userId uuid.UUID) error {
+	return repo.withTx(ctx, func(tx *sql.Tx) error {
+		var deletedAt time.Time
+		SQL := "SELECT deleted_at FROM users WHERE id = ? AND deleted_at IS NOT NULL"
+		err := tx.QueryRowContext(ctx, SQL, userId).Scan(&deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUserNotDeleted, userId)
+		}
 		if err != nil {
-			return model.User{}, fmt.Errorf("failed to scan user data: %w", err)
+			return fmt.Errorf("failed to read deleted user: %w", err)
 		}
-		return user, nil
-	} else {
-		return model.User{}, fmt.Errorf("user with id %s not found", userId)
+
+		SQL = "UPDATE users SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL"
+		_, err = tx.ExecContext(ctx, SQL, time.Now().UTC(), userId)
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%w: %s", ErrRestoreConflict, userId)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to execute restore query: %w", err)
+		}
+
+		return writeAudit(ctx, tx, model.AuditActionRestore, userId, deletedAtChange(&deletedAt, nil))
+	})
+}
+
+// Purge permanently removes users that were deleted before deletedBefore and
+// returns how many were removed.
+func (repo *UserRepositoryImpl) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+
+	err := repo.withTx(ctx, func(tx *sql.Tx) error {
+		SQL := "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?"
+		result, err := tx.ExecContext(ctx, SQL, deletedBefore.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to execute purge query: %w", err)
+		}
+
+		purged, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
+
+	return purged, nil
 }
 
-func (repo *UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (model.User, error) {
-	tx, err := repo.Db.Begin()
+// FindById returns the active user with userId, or ErrNotFound.
+func (repo *UserRepositoryImpl) FindById(ctx context.Context, userId uuid.UUID) (model.User, error) {
+	user, err := repo.findOne(ctx, repo.findByIdStmt, userId)
+	if errors.Is(err, ErrNotFound) {
+		return model.User{}, fmt.Errorf("%w: %s", ErrNotFound, userId)
+	}
 	if err != nil {
-		return model.User{}, fmt.Errorf("failed to begin transaction: %w", err)
+		return model.User{}, fmt.Errorf("failed to find user by id: %w", err)
 	}
-	defer helper.CommitOrRollback(tx)
 
-	SQL := "SELECT id, name, surname, email, phone_number, created_at FROM users WHERE email = ?"
-	result, err := tx.QueryContext(ctx, SQL, email)
+	return user, nil
+}
+
+// CanonicalEmail returns the form of email that users are unique and looked
+// up by.
+func (repo *UserRepositoryImpl) CanonicalEmail(email string) (string, error) {
+	return helper.CanonicalEmail(email, repo.emailRules)
+}
+
+// FindByEmail returns the active user whose email has the same canonical
+// form as email, or ErrNotFound. An email without a canonical form fails with
+// helper.ErrInvalidEmail.
+func (repo *UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	canonicalEmail, err := repo.CanonicalEmail(email)
 	if err != nil {
-		return model.User{}, fmt.Errorf("failed to execute query to find user by email: %w", err)
+		return model.User{}, err
 	}
-	defer result.Close()
 
-	user := model.User{}
-	if result.Next() {
-		err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt)
-		if err != nil {
-			return model.User{}, fmt.Errorf("failed to scan user data: %w", err)
-		}
-		return user, nil
+	user, err := repo.findOne(ctx, repo.findByEmailStmt, canonicalEmail)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return model.User{}, fmt.Errorf("failed to find user by email: %w", err)
 	}
 
-	return model.User{}, nil
+	return user, err
 }
 
+// FindByPhoneNumber returns the active user with phoneNumber, or ErrNotFound.
 func (repo *UserRepositoryImpl) FindByPhoneNumber(ctx context.Context, phoneNumber string) (model.User, error) {
-	tx, err := repo.Db.Begin()
-	if err != nil {
-		return model.User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	user, err := repo.findOne(ctx, repo.findByPhoneNumberStmt, phoneNumber)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return model.User{}, fmt.Errorf("failed to find user by phone number: %w", err)
 	}
-	defer helper.CommitOrRollback(tx)
 
-	SQL := "SELECT id, name, surname, email, phone_number, created_at FROM users WHERE phone_number = ?"
-	result, err := tx.QueryContext(ctx, SQL, phoneNumber)
+	return user, err
+}
+
+// findOne reads the user selected by stmt. Single reads do not need a
+// transaction; with WAL they also do not wait for writers.
+func (repo *UserRepositoryImpl) findOne(ctx context.Context, stmt *sql.Stmt, arg interface{}) (model.User, error) {
+	done, err := repo.track()
 	if err != nil {
-		return model.User{}, fmt.Errorf("failed to execute query to find user by phone number: %w", err)
+		return model.User{}, err
 	}
-	defer result.Close()
+	defer done()
 
 	user := model.User{}
-	if result.Next() {
-		err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt)
-		if err != nil {
-			return model.User{}, fmt.Errorf("failed to scan user data: %w", err)
-		}
-		return user, nil
+	err = stmt.QueryRowContext(ctx, arg).Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt, &user.UpdatedAt, &user.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, ErrNotFound
+	}
+	if err != nil {
+		return model.User{}, err
 	}
 
-	return model.User{}, nil
+	return user, nil
 }
 
 func (repo *UserRepositoryImpl) FindAll(ctx context.Context) ([]model.User, error) {
-	tx, err := repo.Db.Begin()
+	done, err := repo.track()
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, err
 	}
+	defer done()
 
-	defer helper.CommitOrRollback(tx)
-
-	SQL := "SELECT id, name, surname, email, phone_number, created_at FROM users"
-	result, err := tx.QueryContext(ctx, SQL)
+	result, err := repo.findAllStmt.QueryContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query to find all users: %w", err)
 	}
@@ -168,12 +459,216 @@ func (repo *UserRepositoryImpl) FindAll(ctx context.Context) ([]model.User, erro
 	var users []model.User
 	for result.Next() {
 		user := model.User{}
-		err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt)
+		err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt, &user.UpdatedAt, &user.Version)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user data: %w", err)
 		}
 		users = append(users, user)
 	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
 
 	return users, nil
-}
\ No newline at end of file
+}
+
+// FindPage returns one page of users matching query.Filter in the order given
+// by query.Sort. With a cursor the page is located by keyset, otherwise by
+// query.Offset. The total and the page are read one after the other, so a
+// write in between can make them disagree.
+func (repo *UserRepositoryImpl) FindPage(ctx context.Context, query UserQuery) (UserPage, error) {
+	page := UserPage{Users: []model.User{}}
+
+	fields := query.Sort
+	if len(fields) == 0 {
+		fields, _ = ParseSort(DefaultSort)
+	}
+
+	conditions, args := filterConditions(query.Filter)
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	before := query.Cursor != nil && query.Cursor.Before
+	pageConditions, pageArgs := conditions, args
+	if query.Cursor != nil {
+		condition, cursorArgs, err := keysetCondition(fields, query.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		pageConditions = append(append([]string{}, conditions...), condition)
+		pageArgs = append(append([]interface{}{}, args...), cursorArgs...)
+	}
+	pageWhere := ""
+	if len(pageConditions) > 0 {
+		pageWhere = " WHERE " + strings.Join(pageConditions, " AND ")
+	}
+
+	var raw []rawTimestamps
+	err := repo.read(ctx, func(db *sql.DB) error {
+		SQL := "SELECT COUNT(*) FROM users" + where
+		if err := db.QueryRowContext(ctx, SQL, args...).Scan(&page.Total); err != nil {
+			return fmt.Errorf("failed to count users: %w", err)
+		}
+
+		// One extra row tells whether another page follows in this direction.
+		SQL = "SELECT id, name, surname, email, phone_number, created_at, updated_at, deleted_at, version, CAST(created_at AS TEXT), CAST(updated_at AS TEXT) FROM users" +
+			pageWhere + " ORDER BY " + orderByClause(fields, before) + " LIMIT ?"
+		queryArgs := append(pageArgs, query.Limit+1)
+		if query.Cursor == nil {
+			SQL += " OFFSET ?"
+			queryArgs = append(queryArgs, query.Offset)
+		}
+
+		result, err := db.QueryContext(ctx, SQL, queryArgs...)
+		if err != nil {
+			return fmt.Errorf("failed to execute query to find users: %w", err)
+		}
+		defer result.Close()
+
+		for result.Next() {
+			user := model.User{}
+			var timestamps rawTimestamps
+			err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Version, &timestamps.CreatedAt, &timestamps.UpdatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to scan user data: %w", err)
+			}
+			page.Users = append(page.Users, user)
+			raw = append(raw, timestamps)
+		}
+		return result.Err()
+	})
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	hasMore := len(page.Users) > query.Limit
+	if hasMore {
+		page.Users = page.Users[:query.Limit]
+		raw = raw[:query.Limit]
+	}
+	if before {
+		for i, j := 0, len(page.Users)-1; i < j; i, j = i+1, j-1 {
+			page.Users[i], page.Users[j] = page.Users[j], page.Users[i]
+			raw[i], raw[j] = raw[j], raw[i]
+		}
+	}
+	if len(page.Users) == 0 {
+		return page, nil
+	}
+
+	// Paging backwards always leaves a next page and paging forwards always
+	// leaves a previous one; the other direction depends on the extra row.
+	hasNext, hasPrev := hasMore, query.Offset > 0
+	if query.Cursor != nil {
+		hasNext, hasPrev = before || hasMore, !before || hasMore
+	}
+
+	last := len(page.Users) - 1
+	if hasNext {
+		page.NextCursor = cursorFor(fields, page.Users[last], raw[last], false)
+	}
+	if hasPrev {
+		page.PrevCursor = cursorFor(fields, page.Users[0], raw[0], true)
+	}
+
+	return page, nil
+}
+
+// Export calls fn for every user matching filter, oldest first, stopping at
+// the first error fn returns. Users are read from a single query outside a
+// transaction, so a long export neither holds the write lock nor keeps more
+// than one user in memory.
+func (repo *UserRepositoryImpl) Export(ctx context.Context, filter UserFilter, fn func(user model.User) error) error {
+	done, err := repo.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	conditions, args := filterConditions(filter)
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	SQL := "SELECT id, name, surname, email, phone_number, created_at, updated_at, deleted_at, version FROM users" + where + " ORDER BY created_at, id"
+	result, err := repo.Db.QueryContext(ctx, SQL, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query to export users: %w", err)
+	}
+	defer result.Close()
+
+	for result.Next() {
+		user := model.User{}
+		err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Version)
+		if err != nil {
+			return fmt.Errorf("failed to scan user data: %w", err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return result.Err()
+}
+
+// Search finds users whose name, surname or email contain words starting
+// with every word of query. With FTS5 results are ranked by bm25 with name
+// and surname weighted above email; with the FTS4 fallback they are ordered
+// by name.
+func (repo *UserRepositoryImpl) Search(ctx context.Context, query string, page Page) (SearchPage, error) {
+	match, err := matchExpression(query)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	searchPage := SearchPage{Results: []SearchResult{}}
+
+	err = repo.read(ctx, func(db *sql.DB) error {
+		var definition string
+		SQL := "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'users_search'"
+		if err := db.QueryRowContext(ctx, SQL).Scan(&definition); err != nil {
+			return fmt.Errorf("failed to find search index: %w", err)
+		}
+
+		SQL = "SELECT COUNT(*) FROM users_search JOIN users u ON u.id = users_search.id WHERE users_search MATCH ? AND u.deleted_at IS NULL"
+		if err := db.QueryRowContext(ctx, SQL, match).Scan(&searchPage.Total); err != nil {
+			return fmt.Errorf("failed to count search results: %w", err)
+		}
+
+		SQL = "SELECT u.id, u.name, u.surname, u.email, u.phone_number, u.created_at, u.updated_at, u.version, " +
+			"snippet(users_search, '" + snippetOpen + "', '" + snippetClose + "', '…', -1, 10), 0 " +
+			"FROM users_search JOIN users u ON u.id = users_search.id " +
+			"WHERE users_search MATCH ? AND u.deleted_at IS NULL ORDER BY u.name, u.surname, u.id LIMIT ? OFFSET ?"
+		if strings.Contains(strings.ToLower(definition), "fts5") {
+			SQL = "SELECT u.id, u.name, u.surname, u.email, u.phone_number, u.created_at, u.updated_at, u.version, " +
+				"snippet(users_search, -1, '" + snippetOpen + "', '" + snippetClose + "', '…', 10), bm25(users_search, 0, 10, 10, 5) AS rank " +
+				"FROM users_search JOIN users u ON u.id = users_search.id " +
+				"WHERE users_search MATCH ? AND u.deleted_at IS NULL ORDER BY rank, u.id LIMIT ? OFFSET ?"
+		}
+
+		result, err := db.QueryContext(ctx, SQL, match, page.Limit, page.Offset)
+		if err != nil {
+			return fmt.Errorf("failed to execute search query: %w", err)
+		}
+		defer result.Close()
+
+		for result.Next() {
+			searchResult := SearchResult{}
+			user := &searchResult.User
+			err := result.Scan(&user.Id, &user.Name, &user.Surname, &user.Email, &user.PhoneNumber, &user.CreatedAt, &user.UpdatedAt, &user.Version, &searchResult.Snippet, &searchResult.Rank)
+			if err != nil {
+				return fmt.Errorf("failed to scan search result: %w", err)
+			}
+			searchResult.Snippet = escapeSnippet(searchResult.Snippet)
+			searchPage.Results = append(searchPage.Results, searchResult)
+		}
+		return result.Err()
+	})
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	return searchPage, nil
+}
@@ -2,13 +2,21 @@ package repository_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
 	"testing"
 	"time"
+	"user-crud/helper"
+	"user-crud/migration"
 	"user-crud/model"
 	"user-crud/repository"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,22 +34,27 @@ func TestSave(t *testing.T) {
 		t.Fatalf("Failed to parse date: %v", err)
 	}
 
-	repo := repository.NewUserRepository(db)
+	expectPrepares(mock)
+	repo := newRepository(t, db)
 	user := model.User{
 		Name:        "John",
 		Surname:     "Doe",
-		Email:       "john.doe@example.com",
+		Email:       "John.Doe@Example.com",
 		PhoneNumber: "1234567890",
 		CreatedAt:   createdAt,
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectExec("^INSERT INTO users \\(id, name, surname, email, phone_number, created_at\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)$").
-		WithArgs(sqlmock.AnyArg(), user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt).
+	mock.ExpectExec("^INSERT INTO users \\(id, name, surname, email, email_canonical, phone_number, created_at, updated_at\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$").
+		WithArgs(sqlmock.AnyArg(), user.Name, user.Surname, user.Email, "john.doe@example.com", user.PhoneNumber, user.CreatedAt, user.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO audit_log").
+		WithArgs("admin", model.AuditActionCreate, sqlmock.AnyArg(), sqlmock.AnyArg(), "req-1", "10.0.0.1", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	err = repo.Save(context.Background(), user)
+	ctx := helper.WithRequestInfo(context.Background(), helper.RequestInfo{Actor: "admin", RequestId: "req-1", ClientIP: "10.0.0.1"})
+	err = repo.Save(ctx, user)
 	assert.NoError(t, err, "Expected no error while saving user")
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -50,6 +63,30 @@ func TestSave(t *testing.T) {
 }
 
 
+func TestSaveRollsBackOnError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	expectPrepares(mock)
+	repo := newRepository(t, db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").
+		WillReturnError(errors.New("UNIQUE constraint failed: users.email"))
+	mock.ExpectRollback()
+
+	err = repo.Save(context.Background(), model.User{Name: "John", Email: "john.doe@example.com"})
+	assert.Error(t, err, "Expected insert failure to be returned")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
+
+
 func TestFindById(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -57,17 +94,16 @@ func TestFindById(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := repository.NewUserRepository(db)
+	expectPrepares(mock)
+	repo := newRepository(t, db)
 	userId := uuid.New()
 
-	rows := sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at"}).
-		AddRow(userId, "John", "Doe", "john.doe@example.com", "1234567890", time.Now())
+	rows := sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at", "updated_at", "version"}).
+		AddRow(userId, "John", "Doe", "john.doe@example.com", "1234567890", time.Now(), time.Now(), 1)
 
-	mock.ExpectBegin()
-	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at FROM users WHERE id = ?").
+	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE id = ?").
 		WithArgs(userId).
 		WillReturnRows(rows)
-	mock.ExpectCommit()
 
 	user, err := repo.FindById(context.Background(), userId)
 	assert.NoError(t, err, "Expected no error while finding user by ID")
@@ -86,18 +122,22 @@ func TestDelete(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := repository.NewUserRepository(db)
+	expectPrepares(mock)
+	repo := newRepository(t, db)
 	userId := uuid.New()
 	mock.ExpectBegin()
 
-	mock.ExpectExec("DELETE FROM users WHERE id = ?").
-		WithArgs(userId).
+	mock.ExpectExec("UPDATE users SET deleted_at = \\?, updated_at = \\?, version = version \\+ 1 WHERE id = \\? AND version = \\? AND deleted_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), userId, 1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^INSERT INTO audit_log").
+		WithArgs(repository.SystemActor, model.AuditActionDelete, userId, sqlmock.AnyArg(), "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 
 	mock.ExpectCommit()
 
-	err = repo.Delete(context.Background(), userId)
+	err = repo.Delete(context.Background(), userId, 1)
 
 	assert.NoError(t, err, "Expected no error during delete operation")
 
@@ -113,7 +153,8 @@ func TestFindAll(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := repository.NewUserRepository(db)
+	expectPrepares(mock)
+	repo := newRepository(t, db)
 
 	users := []model.User{
 		{
@@ -134,18 +175,13 @@ func TestFindAll(t *testing.T) {
 		},
 	}
 
-	mock.ExpectBegin()
-
-	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at FROM users").
+	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users").
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at"}).
-				AddRow(users[0].Id, users[0].Name, users[0].Surname, users[0].Email, users[0].PhoneNumber, users[0].CreatedAt).
-				AddRow(users[1].Id, users[1].Name, users[1].Surname, users[1].Email, users[1].PhoneNumber, users[1].CreatedAt),
+			sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at", "updated_at", "version"}).
+				AddRow(users[0].Id, users[0].Name, users[0].Surname, users[0].Email, users[0].PhoneNumber, users[0].CreatedAt, users[0].CreatedAt, 1).
+				AddRow(users[1].Id, users[1].Name, users[1].Surname, users[1].Email, users[1].PhoneNumber, users[1].CreatedAt, users[1].CreatedAt, 1),
 		)
 
-
-	mock.ExpectCommit()
-
 	result, err := repo.FindAll(context.Background())
 
 	assert.NoError(t, err, "Expected no error during FindAll operation")
@@ -165,7 +201,8 @@ func TestFindByEmail(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := repository.NewUserRepository(db)
+	expectPrepares(mock)
+	repo := newRepository(t, db)
 
 	email := "john.doe@example.com"
 	user := model.User{
@@ -177,17 +214,13 @@ func TestFindByEmail(t *testing.T) {
 		CreatedAt:   time.Now(),
 	}
 
-	mock.ExpectBegin()
-
-	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at FROM users WHERE email = ?").
+	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE email_canonical = ?").
 		WithArgs(email).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at"}).
-				AddRow(user.Id, user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt),
+			sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at", "updated_at", "version"}).
+				AddRow(user.Id, user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt, user.CreatedAt, 1),
 		)
 
-	mock.ExpectCommit()
-
 	result, err := repo.FindByEmail(context.Background(), email)
 
 	assert.NoError(t, err, "Expected no error during FindByEmail operation")
@@ -207,7 +240,8 @@ func TestFindByPhoneNumber(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := repository.NewUserRepository(db)
+	expectPrepares(mock)
+	repo := newRepository(t, db)
 
 	phoneNumber := "1234567890"
 	user := model.User{
@@ -219,17 +253,13 @@ func TestFindByPhoneNumber(t *testing.T) {
 		CreatedAt:   time.Now(),
 	}
 
-	mock.ExpectBegin()
-
-	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at FROM users WHERE phone_number = ?").
+	mock.ExpectQuery("SELECT id, name, surname, email, phone_number, created_at, updated_at, version FROM users WHERE phone_number = ?").
 		WithArgs(phoneNumber).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at"}).
-				AddRow(user.Id, user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt),
+			sqlmock.NewRows([]string{"id", "name", "surname", "email", "phone_number", "created_at", "updated_at", "version"}).
+				AddRow(user.Id, user.Name, user.Surname, user.Email, user.PhoneNumber, user.CreatedAt, user.CreatedAt, 1),
 		)
 
-	mock.ExpectCommit()
-
 	result, err := repo.FindByPhoneNumber(context.Background(), phoneNumber)
 
 	assert.NoError(t, err, "Expected no error during FindByPhoneNumber operation")
@@ -240,3 +270,472 @@ func TestFindByPhoneNumber(t *testing.T) {
 		t.Errorf("Mock expectations were not met: %v", err)
 	}
 }
+
+func TestDrainWaitsForInFlightTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	expectPrepares(mock)
+	repo := newRepository(t, db)
+	userId := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET deleted_at = \\?, updated_at = \\?, version = version \\+ 1 WHERE id = \\? AND version = \\? AND deleted_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), userId, 1).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	deleted := make(chan error, 1)
+	go func() {
+		deleted <- repo.Delete(context.Background(), userId, 1)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	err = repo.(repository.Drainer).Drain(context.Background())
+	assert.NoError(t, err, "Expected drain to wait for the delete to finish")
+
+	select {
+	case err := <-deleted:
+		assert.NoError(t, err, "Expected in-flight delete to complete")
+	default:
+		t.Fatal("Drain returned before the in-flight transaction finished")
+	}
+
+	err = repo.Delete(context.Background(), userId, 1)
+	assert.ErrorIs(t, err, repository.ErrShuttingDown, "Expected new work to be rejected after drain")
+	_, err = repo.FindById(context.Background(), userId)
+	assert.ErrorIs(t, err, repository.ErrShuttingDown, "Expected new reads to be rejected after drain")
+
+	assert.NoError(t, repo.(io.Closer).Close(), "Expected prepared statements to close")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+// expectPrepares expects the statements NewUserRepository prepares.
+func expectPrepares(mock sqlmock.Sqlmock) {
+	mock.ExpectPrepare("SELECT (.+) FROM users WHERE id = \\? AND deleted_at IS NULL")
+	mock.ExpectPrepare("SELECT (.+) FROM users WHERE email_canonical = \\? AND deleted_at IS NULL")
+	mock.ExpectPrepare("SELECT (.+) FROM users WHERE phone_number = \\? AND deleted_at IS NULL")
+	mock.ExpectPrepare("SELECT (.+) FROM users WHERE deleted_at IS NULL$")
+}
+
+func newRepository(t testing.TB, db *sql.DB) repository.UserRepository {
+	repo, err := repository.NewUserRepository(db, helper.EmailRules{})
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	return repo
+}
+
+func openMigratedDB(t testing.TB) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.New(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	return db
+}
+
+func TestFindPageCursorsMatchOffsetPaging(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	createdAt := time.Date(2024, 12, 30, 12, 0, 0, 0, time.UTC)
+	names := []string{"Ada", "Bob", "Ada", "Cem", "Bob", "Ada", "Dan"}
+	for i, name := range names {
+		err := repo.Save(ctx, model.User{
+			Name:        name,
+			Surname:     "Doe",
+			Email:       fmt.Sprintf("user%d@example.com", i),
+			PhoneNumber: fmt.Sprintf("555000000%d", i),
+			CreatedAt:   createdAt.Add(time.Duration(i%3) * time.Hour),
+		})
+		assert.NoError(t, err)
+	}
+
+	sort, err := repository.ParseSort("name,-created_at")
+	assert.NoError(t, err)
+
+	all, err := repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: len(names)})
+	assert.NoError(t, err)
+	assert.Len(t, all.Users, len(names))
+	assert.Equal(t, len(names), all.Total)
+	assert.Empty(t, all.NextCursor)
+
+	var forward []model.User
+	var cursors []*repository.Cursor
+	query := repository.UserQuery{Sort: sort, Limit: 3}
+	for {
+		page, err := repo.FindPage(ctx, query)
+		assert.NoError(t, err)
+		forward = append(forward, page.Users...)
+		cursors = append(cursors, query.Cursor)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor, err = repository.DecodeCursor(page.NextCursor)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, all.Users, forward)
+	assert.Len(t, cursors, 3)
+
+	last, err := repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: 3, Cursor: cursors[2]})
+	assert.NoError(t, err)
+	prevCursor, err := repository.DecodeCursor(last.PrevCursor)
+	assert.NoError(t, err)
+
+	previous, err := repo.FindPage(ctx, repository.UserQuery{Sort: sort, Limit: 3, Cursor: prevCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, all.Users[3:6], previous.Users)
+	assert.NotEmpty(t, previous.PrevCursor)
+	assert.NotEmpty(t, previous.NextCursor)
+
+	filtered, err := repo.FindPage(ctx, repository.UserQuery{
+		Filter: repository.UserFilter{Name: "ada"},
+		Sort:   sort,
+		Limit:  10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, filtered.Total)
+
+	otherSort, _ := repository.ParseSort("email")
+	_, err = repo.FindPage(ctx, repository.UserQuery{Sort: otherSort, Limit: 3, Cursor: prevCursor})
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+}
+
+func TestSearch(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	users := []model.User{
+		{Name: "Elif", Surname: "Çelik", Email: "elif.celik@example.com", PhoneNumber: "5550000001"},
+		{Name: "Celal", Surname: "Yılmaz", Email: "celal@example.com", PhoneNumber: "5550000002"},
+		{Name: "John", Surname: "Doe", Email: "johndoe@celikmail.com", PhoneNumber: "5550000003"},
+		{Name: "Jane", Surname: "Smith", Email: "jane@example.com", PhoneNumber: "5550000004"},
+	}
+	for _, user := range users {
+		user.CreatedAt = time.Now()
+		assert.NoError(t, repo.Save(ctx, user))
+	}
+
+	page, err := repo.Search(ctx, "cel", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Results, 3)
+	for _, result := range page.Results {
+		assert.Contains(t, result.Snippet, repository.SnippetStart)
+	}
+	if page.Results[0].Rank != 0 {
+		// Ranked with bm25 when built with FTS5: a match in the email only
+		// comes after matches in the name or surname.
+		assert.Equal(t, "John", page.Results[2].User.Name)
+	}
+
+	page, err = repo.Search(ctx, "ELIF cel", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	assert.Equal(t, "Elif", page.Results[0].User.Name)
+
+	page, err = repo.Search(ctx, "cel", repository.Page{Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Results, 1)
+
+	page, err = repo.Search(ctx, `name:"OR" NOT`, repository.Page{Limit: 10})
+	assert.NoError(t, err, "query syntax in user input should be treated as words")
+	assert.Equal(t, 0, page.Total)
+
+	_, err = repo.Search(ctx, "  @!  ", repository.Page{Limit: 10})
+	assert.ErrorIs(t, err, repository.ErrInvalidSearchQuery)
+}
+
+func TestSoftDeleteRestoreAndPurge(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	user := model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}
+	assert.NoError(t, repo.Save(ctx, user))
+
+	saved, err := repo.FindByEmail(ctx, user.Email)
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.Delete(ctx, saved.Id, saved.Version))
+
+	_, err = repo.FindById(ctx, saved.Id)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "deleted users should not be found")
+	_, err = repo.FindByEmail(ctx, user.Email)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	search, err := repo.Search(ctx, "john", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, search.Total)
+
+	page, err := repo.FindPage(ctx, repository.UserQuery{Limit: 10, Filter: repository.UserFilter{IncludeDeleted: true}})
+	assert.NoError(t, err)
+	assert.Len(t, page.Users, 1)
+	assert.NotNil(t, page.Users[0].DeletedAt)
+
+	assert.NoError(t, repo.Restore(ctx, saved.Id))
+	assert.ErrorIs(t, repo.Restore(ctx, saved.Id), repository.ErrUserNotDeleted)
+	restored, err := repo.FindById(ctx, saved.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, saved.Version+2, restored.Version, "delete and restore should both bump the version")
+
+	assert.NoError(t, repo.Delete(ctx, saved.Id, restored.Version))
+	assert.NoError(t, repo.Save(ctx, user), "a deleted user's email and phone number can be reused")
+
+	purged, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged, "users deleted within the retention window are kept")
+
+	purged, err = repo.Purge(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.ErrorIs(t, repo.Restore(ctx, saved.Id), repository.ErrUserNotDeleted)
+
+	page, err = repo.FindPage(ctx, repository.UserQuery{Limit: 10, Filter: repository.UserFilter{IncludeDeleted: true}})
+	assert.NoError(t, err)
+	assert.Len(t, page.Users, 1)
+	assert.Nil(t, page.Users[0].DeletedAt)
+}
+
+func TestUpdateChecksVersion(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+
+	user, err := repo.FindByEmail(ctx, "john.doe@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), user.Version)
+
+	first, second := user, user
+	first.Name = "Johnny"
+	second.Name = "Jon"
+
+	assert.NoError(t, repo.Update(ctx, user.Id, first))
+
+	err = repo.Update(ctx, user.Id, second)
+	var conflict *repository.VersionConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(1), conflict.Expected)
+	assert.Equal(t, int64(2), conflict.Current)
+
+	err = repo.Delete(ctx, user.Id, 1)
+	assert.ErrorAs(t, err, &conflict)
+
+	current, err := repo.FindById(ctx, user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Johnny", current.Name)
+	assert.Equal(t, int64(2), current.Version)
+
+	err = repo.Update(ctx, uuid.New(), current)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.False(t, errors.As(err, &conflict), "missing users are not version conflicts")
+
+	err = repo.Delete(ctx, uuid.New(), 1)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestUpdateReportsDuplicates(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()}))
+
+	jane, err := repo.FindByEmail(ctx, "jane.doe@example.com")
+	assert.NoError(t, err)
+
+	taken := jane
+	taken.Email = "john.doe@example.com"
+	assert.ErrorIs(t, repo.Update(ctx, jane.Id, taken), repository.ErrDuplicateEmail)
+
+	taken = jane
+	taken.PhoneNumber = "5550000001"
+	assert.ErrorIs(t, repo.Update(ctx, jane.Id, taken), repository.ErrDuplicatePhoneNumber)
+
+	_, err = repo.FindByPhoneNumber(ctx, "5550000003")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestUpdatedAtTracksChanges(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	createdAt := time.Now().Add(-time.Hour).UTC()
+	for i, name := range []string{"Ada", "Bob", "Cem"} {
+		user := model.User{Name: name, Surname: "Doe", Email: fmt.Sprintf("%s@example.com", name), PhoneNumber: fmt.Sprintf("555000000%d", i), CreatedAt: createdAt}
+		assert.NoError(t, repo.Save(ctx, user))
+	}
+
+	ada, err := repo.FindByEmail(ctx, "Ada@example.com")
+	assert.NoError(t, err)
+	assert.True(t, ada.UpdatedAt.Equal(createdAt), "new users are updated when they are created")
+
+	since := time.Now().UTC()
+	ada.Surname = "Lovelace"
+	assert.NoError(t, repo.Update(ctx, ada.Id, ada))
+	bob, err := repo.FindByEmail(ctx, "Bob@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Delete(ctx, bob.Id, bob.Version))
+
+	updated, err := repo.FindById(ctx, ada.Id)
+	assert.NoError(t, err)
+	assert.False(t, updated.UpdatedAt.Before(since))
+
+	sort, _ := repository.ParseSort("updated_at")
+	page, err := repo.FindPage(ctx, repository.UserQuery{
+		Filter: repository.UserFilter{UpdatedSince: &since, IncludeDeleted: true},
+		Sort:   sort,
+		Limit:  1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.Total, "updates and deletes count as changes")
+	if assert.Len(t, page.Users, 1) {
+		assert.Equal(t, "Ada", page.Users[0].Name)
+	}
+
+	cursor, err := repository.DecodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	page, err = repo.FindPage(ctx, repository.UserQuery{
+		Filter: repository.UserFilter{UpdatedSince: &since, IncludeDeleted: true},
+		Sort:   sort,
+		Limit:  1,
+		Cursor: cursor,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Users, 1) {
+		assert.Equal(t, "Bob", page.Users[0].Name)
+	}
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestSaveAll(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+
+	batch := []model.User{
+		{Name: "Ada", Surname: "Doe", Email: "ada@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()},
+		{Name: "Jon", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000003", CreatedAt: time.Now()},
+		{Name: "Bob", Surname: "Doe", Email: "bob@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()},
+	}
+
+	results, err := repo.SaveAll(ctx, batch, true)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, repository.ErrDuplicateEmail)
+	assert.ErrorIs(t, results[2].Err, repository.ErrDuplicatePhoneNumber)
+
+	users, err := repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1, "an atomic batch with failures saves nothing")
+
+	results, err = repo.SaveAll(ctx, batch, false)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.Error(t, results[2].Err)
+
+	saved, err := repo.FindById(ctx, results[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", saved.Name)
+
+	users, err = repo.FindAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+}
+
+func TestExport(t *testing.T) {
+	db := openMigratedDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	emails := []string{"c@example.com", "a@example.com", "b@other.org", "d@example.com"}
+	for i, email := range emails {
+		user := model.User{Name: "User", Surname: "Doe", Email: email, PhoneNumber: fmt.Sprintf("555000000%d", i), CreatedAt: createdAt.Add(time.Duration(i) * time.Hour)}
+		assert.NoError(t, repo.Save(ctx, user))
+	}
+
+	deleted, err := repo.FindByEmail(ctx, "d@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Delete(ctx, deleted.Id, deleted.Version))
+
+	var exported []string
+	err = repo.Export(ctx, repository.UserFilter{EmailDomain: "example.com"}, func(user model.User) error {
+		exported = append(exported, user.Email)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c@example.com", "a@example.com"}, exported)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.Export(ctx, repository.UserFilter{}, func(user model.User) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestReadsDoNotWaitForWriteTransactions(t *testing.T) {
+	db := openConfiguredDB(t)
+	ctx := context.Background()
+
+	repo := newRepository(t, db)
+	user := model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}
+	assert.NoError(t, repo.Save(ctx, user))
+
+	// With tx_lock immediate the open transaction holds the write lock until
+	// it ends.
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "UPDATE users SET name = 'Johnny'")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	page, err := repo.FindPage(ctx, repository.UserQuery{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	if assert.Len(t, page.Users, 1) {
+		assert.Equal(t, "John", page.Users[0].Name, "uncommitted writes are not seen")
+	}
+
+	searchPage, err := repo.Search(ctx, "john", repository.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, searchPage.Total)
+
+	auditPage, err := repository.NewAuditRepository(db).FindPage(ctx, repository.AuditQuery{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, auditPage.Total)
+}
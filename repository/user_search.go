@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+	"user-crud/model"
+)
+
+var ErrInvalidSearchQuery = errors.New("search query has no searchable terms")
+
+// Snippets are HTML: the matched words are wrapped in SnippetStart and
+// SnippetEnd, and the text around them, which comes from users, is escaped so
+// it can be rendered as is.
+const (
+	SnippetStart = "<mark>"
+	SnippetEnd   = "</mark>"
+)
+
+// snippetOpen and snippetClose mark the matched words in the snippets the
+// search index returns, until escapeSnippet replaces them.
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	User    model.User
+	Snippet string
+	Rank    float64
+}
+
+type SearchPage struct {
+	Results []SearchResult
+	Total   int
+}
+
+// escapeSnippet HTML-escapes a snippet whose matches are marked with
+// snippetOpen and snippetClose and marks them with SnippetStart and
+// SnippetEnd instead. Markers that do not pair up, which only control
+// characters typed into a field can cause, are dropped or closed.
+func escapeSnippet(raw string) string {
+	var snippet strings.Builder
+	open := false
+
+	for {
+		i := strings.IndexAny(raw, snippetOpen+snippetClose)
+		if i < 0 {
+			snippet.WriteString(html.EscapeString(raw))
+			break
+		}
+		snippet.WriteString(html.EscapeString(raw[:i]))
+
+		switch {
+		case raw[i] == snippetOpen[0] && !open:
+			snippet.WriteString(SnippetStart)
+			open = true
+		case raw[i] == snippetClose[0] && open:
+			snippet.WriteString(SnippetEnd)
+			open = false
+		}
+		raw = raw[i+1:]
+	}
+	if open {
+		snippet.WriteString(SnippetEnd)
+	}
+
+	return snippet.String()
+}
+
+// matchExpression turns free text into a full-text query that requires
+// every word, each matched as a prefix. Words are reduced to letters and
+// digits and lower-cased so user input can never form query syntax such as
+// column filters or AND/OR/NOT operators.
+func matchExpression(query string) (string, error) {
+	terms, err := searchTerms(query)
+	if err != nil {
+		return "", err
+	}
+
+	for i, term := range terms {
+		terms[i] = term + "*"
+	}
+
+	return strings.Join(terms, " "), nil
+}
+
+// searchTerms splits query into lower-cased words of letters and digits, the
+// way the search index tokenizes the fields it holds.
+func searchTerms(query string) ([]string, error) {
+	terms := strings.FieldsFunc(strings.ToLower(query), isSeparator)
+	if len(terms) == 0 {
+		return nil, ErrInvalidSearchQuery
+	}
+	return terms, nil
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
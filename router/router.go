@@ -2,19 +2,35 @@ package router
 
 import (
 	"user-crud/controller"
+	"user-crud/middleware"
+
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(userController *controller.UserController) *mux.Router {
+func NewRouter(userController *controller.UserController, auditController *controller.AuditController, healthController *controller.HealthController, timeouts middleware.RouteTimeouts, trustActorHeader bool) *mux.Router {
 	router := mux.NewRouter()
 
+	router.HandleFunc("/healthz", healthController.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", healthController.Readyz).Methods("GET")
+	router.HandleFunc("/cachez", healthController.Cachez).Methods("GET")
+
 	v1 := router.PathPrefix("/api/v1").Subrouter()
+	v1.Use(middleware.RequestInfoMiddleware(trustActorHeader))
+	v1.Use(middleware.TimeoutMiddleware(timeouts))
+
+	v1.HandleFunc("/user", userController.FindAll).Methods("GET").Name("user.list")
+	v1.HandleFunc("/user/search", userController.Search).Methods("GET").Name("user.search")
+	v1.HandleFunc("/user/export", userController.Export).Methods("GET").Name("user.export")
+	v1.HandleFunc("/user/{userId}", userController.FindById).Methods("GET").Name("user.get")
+	v1.HandleFunc("/user", userController.Create).Methods("POST").Name("user.create")
+	v1.HandleFunc("/user/bulk", userController.BulkCreate).Methods("POST").Name("user.bulk_create")
+	v1.HandleFunc("/user/import", userController.Import).Methods("POST").Name("user.import")
+	v1.HandleFunc("/user/{userId}", userController.Update).Methods("PATCH").Name("user.update")
+	v1.HandleFunc("/user/{userId}", userController.Replace).Methods("PUT").Name("user.replace")
+	v1.HandleFunc("/user/{userId}", userController.Delete).Methods("DELETE").Name("user.delete")
+	v1.HandleFunc("/user/{userId}/restore", userController.Restore).Methods("POST").Name("user.restore")
 
-	v1.HandleFunc("/user", userController.FindAll).Methods("GET")
-	v1.HandleFunc("/user/{userId}", userController.FindById).Methods("GET")
-	v1.HandleFunc("/user", userController.Create).Methods("POST")
-	v1.HandleFunc("/user/{userId}", userController.Update).Methods("PATCH")
-	v1.HandleFunc("/user/{userId}", userController.Delete).Methods("DELETE")
+	v1.HandleFunc("/audit", auditController.FindAll).Methods("GET").Name("audit.list")
 
 	return router
 }
\ No newline at end of file
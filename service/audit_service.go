@@ -0,0 +1,11 @@
+package service
+
+import (
+	"context"
+	"user-crud/data/request"
+	"user-crud/data/response"
+)
+
+type AuditService interface {
+	FindAll(ctx context.Context, request request.AuditListRequest) (response.AuditPageResponse, error)
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"user-crud/data/request"
+	"user-crud/data/response"
+	"user-crud/helper"
+	"user-crud/repository"
+
+	"github.com/google/uuid"
+)
+
+type AuditServiceImpl struct {
+	AuditRepository repository.AuditRepository
+}
+
+func NewAuditServiceImpl(auditRepository repository.AuditRepository) AuditService {
+	return &AuditServiceImpl{AuditRepository: auditRepository}
+}
+
+func (service *AuditServiceImpl) FindAll(ctx context.Context, request request.AuditListRequest) (response.AuditPageResponse, error) {
+	err := helper.ValidateStruct(request)
+	if err != nil {
+		return response.AuditPageResponse{}, err
+	}
+
+	query := repository.AuditQuery{
+		Filter: repository.AuditFilter{
+			Actor: request.Actor,
+			From:  request.From,
+			To:    request.To,
+		},
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultPageLimit
+	}
+	if request.UserId != "" {
+		userId, err := uuid.Parse(request.UserId)
+		if err != nil {
+			return response.AuditPageResponse{}, helper.NewErrorResponse(400, "Invalid user ID", nil)
+		}
+		query.Filter.UserId = &userId
+	}
+
+	page, err := service.AuditRepository.FindPage(ctx, query)
+	if err != nil {
+		return response.AuditPageResponse{}, helper.NewInternalErrorResponse(err, "Failed to retrieve audit log")
+	}
+
+	auditResponses := []response.AuditResponse{}
+	for _, entry := range page.Entries {
+		changes := map[string]response.FieldChange{}
+		for field, change := range entry.Changes {
+			changes[field] = response.FieldChange{Before: change.Before, After: change.After}
+		}
+
+		auditResponses = append(auditResponses, response.AuditResponse{
+			Id:        entry.Id,
+			Actor:     entry.Actor,
+			Action:    entry.Action,
+			UserId:    entry.UserId,
+			Changes:   changes,
+			RequestId: entry.RequestId,
+			ClientIP:  entry.ClientIP,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	return response.AuditPageResponse{
+		Entries: auditResponses,
+		Pagination: response.Pagination{
+			Total:  page.Total,
+			Limit:  query.Limit,
+			Offset: query.Offset,
+		},
+	}, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"user-crud/data/request"
+	"user-crud/helper"
+	"user-crud/model"
+	"user-crud/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAuditRepository is a mock implementation of the AuditRepository interface
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) FindPage(ctx context.Context, query repository.AuditQuery) (repository.AuditPage, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(repository.AuditPage), args.Error(1)
+}
+
+func TestFindAllAuditEntries(t *testing.T) {
+	mockRepo := new(MockAuditRepository)
+	service := NewAuditServiceImpl(mockRepo)
+
+	userId := uuid.New()
+	before, after := "John", "Johnny"
+	entries := []model.AuditEntry{
+		{Id: 1, Actor: "alice", Action: model.AuditActionUpdate, UserId: userId, Changes: map[string]model.FieldChange{"name": {Before: &before, After: &after}}},
+	}
+
+	query := repository.AuditQuery{
+		Filter: repository.AuditFilter{UserId: &userId, Actor: "alice"},
+		Limit:  DefaultPageLimit,
+	}
+	mockRepo.On("FindPage", mock.Anything, query).Return(repository.AuditPage{Entries: entries, Total: 1}, nil)
+
+	result, err := service.FindAll(context.Background(), request.AuditListRequest{UserId: userId.String(), Actor: "alice"})
+
+	assert.NoError(t, err)
+	if assert.Len(t, result.Entries, 1) {
+		assert.Equal(t, "Johnny", *result.Entries[0].Changes["name"].After)
+	}
+	assert.Equal(t, 1, result.Pagination.Total)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFindAllAuditEntriesRejectsInvalidUserId(t *testing.T) {
+	mockRepo := new(MockAuditRepository)
+	service := NewAuditServiceImpl(mockRepo)
+
+	_, err := service.FindAll(context.Background(), request.AuditListRequest{UserId: "not-a-uuid"})
+
+	var errorResponse *helper.ErrorResponse
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 400, errorResponse.Code)
+	mockRepo.AssertNotCalled(t, "FindPage", mock.Anything, mock.Anything)
+}
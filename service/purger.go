@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+	"user-crud/repository"
+)
+
+// Purger permanently removes users that have been soft-deleted for longer
+// than Retention.
+type Purger struct {
+	UserRepository repository.UserRepository
+	Retention      time.Duration
+	Interval       time.Duration
+}
+
+func NewPurger(userRepository repository.UserRepository, retention, interval time.Duration) *Purger {
+	return &Purger{UserRepository: userRepository, Retention: retention, Interval: interval}
+}
+
+// PurgeOnce removes the users deleted before now minus Retention.
+func (purger *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	return purger.UserRepository.Purge(ctx, time.Now().Add(-purger.Retention))
+}
+
+// Run purges every Interval until ctx is cancelled. Failures are logged and
+// retried on the next tick.
+func (purger *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(purger.Interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := purger.PurgeOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to purge deleted users: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d users deleted more than %s ago", purged, purger.Retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
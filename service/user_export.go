@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"user-crud/data/request"
+	"user-crud/helper"
+	"user-crud/model"
+	"user-crud/repository"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+
+	// exportFlushRows is how many users are buffered before they are
+	// written out.
+	exportFlushRows = 100
+)
+
+// ExportColumns lists the columns that can be exported, in their default
+// order.
+var ExportColumns = []string{"id", "name", "surname", "email", "phone_number", "created_at", "updated_at"}
+
+func exportValue(user model.User, column string) string {
+	switch column {
+	case "id":
+		return user.Id.String()
+	case "name":
+		return user.Name
+	case "surname":
+		return user.Surname
+	case "email":
+		return user.Email
+	case "phone_number":
+		return user.PhoneNumber
+	case "created_at":
+		return user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updated_at":
+		return user.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
+
+// csvCell keeps a spreadsheet from running value as a formula by prefixing
+// values that start like one with a single quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportColumns validates the requested columns, defaulting to all of them.
+func exportColumns(columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		return ExportColumns, nil
+	}
+
+	known := map[string]bool{}
+	for _, column := range ExportColumns {
+		known[column] = true
+	}
+
+	seen := map[string]bool{}
+	for _, column := range columns {
+		if !known[column] || seen[column] {
+			return nil, helper.NewErrorResponse(400, "Invalid columns parameter", []helper.ValidationError{{
+				Field:   "columns",
+				Tag:     "columns",
+				Message: fmt.Sprintf("Column %q is unknown or listed twice, expected some of %s", column, strings.Join(ExportColumns, ", ")),
+			}})
+		}
+		seen[column] = true
+	}
+	return columns, nil
+}
+
+// Export streams the users matching request to writer as CSV with a header
+// row, or as one JSON object per line. Request errors are returned before
+// anything is written. Errors returned afterwards leave a truncated export
+// behind.
+func (service *UserServiceImpl) Export(ctx context.Context, request request.UserExportRequest, writer io.Writer) error {
+	err := helper.ValidateStruct(request)
+	if err != nil {
+		return err
+	}
+
+	columns, err := exportColumns(request.Columns)
+	if err != nil {
+		return err
+	}
+
+	filter := repository.UserFilter{
+		EmailDomain: request.EmailDomain,
+		CreatedFrom: request.CreatedFrom,
+		CreatedTo:   request.CreatedTo,
+	}
+
+	buffered := bufio.NewWriter(writer)
+	var write func(user model.User) error
+	var flush func() error
+
+	if request.Format == ExportFormatNDJSON {
+		write = func(user model.User) error {
+			buffered.WriteByte('{')
+			for i, column := range columns {
+				if i > 0 {
+					buffered.WriteByte(',')
+				}
+				key, _ := json.Marshal(column)
+				value, _ := json.Marshal(exportValue(user, column))
+				buffered.Write(key)
+				buffered.WriteByte(':')
+				buffered.Write(value)
+			}
+			_, err := buffered.WriteString("}\n")
+			return err
+		}
+		flush = buffered.Flush
+	} else {
+		csvWriter := csv.NewWriter(buffered)
+		if err := csvWriter.Write(columns); err != nil {
+			return err
+		}
+		record := make([]string, len(columns))
+		write = func(user model.User) error {
+			for i, column := range columns {
+				record[i] = csvCell(exportValue(user, column))
+			}
+			return csvWriter.Write(record)
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+			return buffered.Flush()
+		}
+	}
+
+	rows := 0
+	err = service.UserRepository.Export(ctx, filter, func(user model.User) error {
+		if err := write(user); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return helper.NewInternalErrorResponse(err, "Failed to export users")
+	}
+
+	if err := flush(); err != nil {
+		return helper.NewInternalErrorResponse(err, "Failed to export users")
+	}
+	return nil
+}
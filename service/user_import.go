@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"user-crud/data/request"
+	"user-crud/data/response"
+	"user-crud/helper"
+	"user-crud/model"
+	"user-crud/repository"
+)
+
+// DefaultImportChunkSize is how many users Import commits per transaction
+// when the request does not say.
+const DefaultImportChunkSize = 500
+
+// ImportColumns lists the CSV columns Import requires. Header names are
+// matched case-insensitively and in any order.
+var ImportColumns = []string{"name", "surname", "email", "phone_number"}
+
+// importHeader maps the CSV header to the position of each required column.
+// Columns Import does not know are returned as ignored.
+func importHeader(header []string) (map[string]int, []string, error) {
+	required := map[string]bool{}
+	for _, column := range ImportColumns {
+		required[column] = true
+	}
+
+	positions := map[string]int{}
+	var ignored []string
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !required[name] {
+			ignored = append(ignored, name)
+			continue
+		}
+		if _, ok := positions[name]; ok {
+			return nil, nil, helper.NewErrorResponse(400, "Invalid CSV header", []helper.ValidationError{{
+				Field:   name,
+				Tag:     "unique",
+				Message: fmt.Sprintf("Column '%s' is listed twice", name),
+			}})
+		}
+		positions[name] = i
+	}
+
+	var validationErrors []helper.ValidationError
+	for _, column := range ImportColumns {
+		if _, ok := positions[column]; !ok {
+			validationErrors = append(validationErrors, helper.ValidationError{
+				Field:   column,
+				Tag:     "required",
+				Message: fmt.Sprintf("Column '%s' is missing", column),
+			})
+		}
+	}
+	if len(validationErrors) > 0 {
+		return nil, nil, helper.NewErrorResponse(400, "Invalid CSV header", validationErrors)
+	}
+
+	return positions, ignored, nil
+}
+
+// Import creates a user for every row of a CSV file whose header names the
+// ImportColumns. Rows are checked like BulkCreate checks its users, and the
+// valid ones are committed ChunkSize at a time, so a failure part way leaves
+// the earlier chunks in place. With DryRun nothing is written; the rows are
+// checked against the existing users instead.
+//
+// Every row read gets a result. Reading stops at the first malformed row,
+// since the rows after it cannot be told apart reliably; the row gets a 400
+// result and its line is reported as StoppedAtLine.
+func (service *UserServiceImpl) Import(ctx context.Context, reader io.Reader, importRequest request.UserImportRequest) (response.UserImportResponse, error) {
+	if err := helper.ValidateStruct(importRequest); err != nil {
+		return response.UserImportResponse{}, err
+	}
+	chunkSize := importRequest.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultImportChunkSize
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if errors.Is(err, io.EOF) {
+		return response.UserImportResponse{}, helper.NewErrorResponse(400, "CSV file is empty", nil)
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return response.UserImportResponse{}, helper.NewErrorResponse(400, "Invalid CSV header", nil)
+	}
+	if err != nil {
+		return response.UserImportResponse{}, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	positions, ignored, err := importHeader(header)
+	if err != nil {
+		return response.UserImportResponse{}, err
+	}
+
+	importResponse := response.UserImportResponse{
+		DryRun:         importRequest.DryRun,
+		Rows:           []response.ImportRowResult{},
+		IgnoredColumns: ignored,
+	}
+	fail := func(line int, err *helper.ErrorResponse) {
+		importResponse.Rows = append(importResponse.Rows, response.ImportRowResult{Line: line, Status: err.Code, Error: err})
+	}
+
+	// chunk holds the users waiting to be saved and rows the index of their
+	// results.
+	var chunk []model.User
+	var rows []int
+	save := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		saved, err := service.UserRepository.SaveAll(ctx, chunk, false)
+		if err != nil {
+			return helper.NewInternalErrorResponse(err, "Failed to save users")
+		}
+		for j, i := range rows {
+			row := &importResponse.Rows[i]
+			if err := saved[j].Err; err != nil {
+				log.Printf("Failed to import user on line %d: %v", row.Line, err)
+				errorResponse := saveErrorResponse(err)
+				row.Status, row.Error = errorResponse.Code, errorResponse
+				continue
+			}
+			id := saved[j].Id
+			row.Status, row.Id = 201, &id
+		}
+		chunk, rows = nil, nil
+		return nil
+	}
+
+	batch := newBatchChecker(service.canonicalEmail)
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.As(err, &parseErr) {
+			fail(parseErr.StartLine, helper.NewErrorResponse(400, fmt.Sprintf("Invalid CSV: %v", parseErr.Err), nil))
+			importResponse.StoppedAtLine = parseErr.StartLine
+			break
+		}
+		if err != nil {
+			return response.UserImportResponse{}, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		if len(record) != len(header) {
+			fail(line, helper.NewErrorResponse(400, fmt.Sprintf("Row has %d fields, expected %d", len(record), len(header)), nil))
+			continue
+		}
+
+		userRequest := request.UserCreateRequest{
+			Name:        strings.TrimSpace(record[positions["name"]]),
+			Surname:     strings.TrimSpace(record[positions["surname"]]),
+			Email:       strings.TrimSpace(record[positions["email"]]),
+			PhoneNumber: strings.TrimSpace(record[positions["phone_number"]]),
+		}
+		if errorResponse := batch.check(userRequest, fmt.Sprintf("Line %d", line)); errorResponse != nil {
+			fail(line, errorResponse)
+			continue
+		}
+
+		if importRequest.DryRun {
+			errorResponse, err := service.checkUnique(ctx, userRequest)
+			if err != nil {
+				return response.UserImportResponse{}, err
+			}
+			if errorResponse != nil {
+				fail(line, errorResponse)
+				continue
+			}
+			importResponse.Rows = append(importResponse.Rows, response.ImportRowResult{Line: line, Status: 201})
+			continue
+		}
+
+		chunk = append(chunk, newUser(userRequest))
+		rows = append(rows, len(importResponse.Rows))
+		importResponse.Rows = append(importResponse.Rows, response.ImportRowResult{Line: line})
+		if len(chunk) == chunkSize {
+			if err := save(); err != nil {
+				return response.UserImportResponse{}, err
+			}
+		}
+	}
+	if err := save(); err != nil {
+		return response.UserImportResponse{}, err
+	}
+
+	for _, row := range importResponse.Rows {
+		if row.Status == 201 {
+			importResponse.Created++
+		} else {
+			importResponse.Failed++
+		}
+	}
+	return importResponse, nil
+}
+
+// checkUnique reports whether an existing user already has the email or
+// phone number of userRequest, or whether its email has no canonical form,
+// as saving it would.
+func (service *UserServiceImpl) checkUnique(ctx context.Context, userRequest request.UserCreateRequest) (*helper.ErrorResponse, error) {
+	_, err := service.UserRepository.FindByEmail(ctx, userRequest.Email)
+	if err == nil {
+		return saveErrorResponse(repository.ErrDuplicateEmail), nil
+	}
+	if errors.Is(err, helper.ErrInvalidEmail) {
+		return saveErrorResponse(err), nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, helper.NewInternalErrorResponse(err, "Failed to look up user by email")
+	}
+
+	_, err = service.UserRepository.FindByPhoneNumber(ctx, userRequest.PhoneNumber)
+	if err == nil {
+		return saveErrorResponse(repository.ErrDuplicatePhoneNumber), nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, helper.NewInternalErrorResponse(err, "Failed to look up user by phone number")
+	}
+	return nil, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"io"
 	"user-crud/data/request"
 	"user-crud/data/response"
 
@@ -10,8 +11,15 @@ import (
 
 type UserService interface {
 	Create(ctx context.Context, request request.UserCreateRequest) error
+	BulkCreate(ctx context.Context, requests []request.UserCreateRequest, atomic bool) (response.BulkCreateResponse, error)
 	Update(ctx context.Context, request request.UserUpdateRequest, userId uuid.UUID) (response.UserResponse, error)
-	Delete(ctx context.Context, userId uuid.UUID) error
+	Patch(ctx context.Context, userId uuid.UUID, request request.UserPatchRequest) (response.UserResponse, error)
+	Replace(ctx context.Context, userId uuid.UUID, request request.UserReplaceRequest) (response.UserResponse, bool, error)
+	Delete(ctx context.Context, userId uuid.UUID, version int64) error
+	Restore(ctx context.Context, userId uuid.UUID) (response.UserResponse, error)
 	FindById(ctx context.Context, userId uuid.UUID) (response.UserResponse, error)
-	FindAll(ctx context.Context) ([]response.UserResponse, error)
+	FindAll(ctx context.Context, request request.UserListRequest) (response.UserPageResponse, error)
+	Search(ctx context.Context, request request.UserSearchRequest) (response.UserPageResponse, error)
+	Export(ctx context.Context, request request.UserExportRequest, writer io.Writer) error
+	Import(ctx context.Context, reader io.Reader, request request.UserImportRequest) (response.UserImportResponse, error)
 }
\ No newline at end of file
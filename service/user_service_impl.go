@@ -1,8 +1,12 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 	"user-crud/data/request"
 	"user-crud/data/response"
@@ -26,70 +30,267 @@ func (service *UserServiceImpl) Create(ctx context.Context, request request.User
 		return err
 	}
 
-	existingUser, err := service.UserRepository.FindByEmail(ctx, request.Email)
+	user := model.User{
+		Name:        request.Name,
+		Surname:     request.Surname,
+		Email:       request.Email,
+		PhoneNumber: request.PhoneNumber,
+		CreatedAt:  time.Now(),
+	}
 
-	if err != nil {
-		fmt.Print("Error here we couldnt find by email")
-		return err
+	// The unique indexes decide whether the email and phone number are
+	// free, so concurrent creates cannot both take them.
+	if err := service.UserRepository.Save(ctx, user); err != nil {
+		log.Printf("Failed to save user: %v", err)
+		return saveErrorResponse(err)
 	}
 
-	if existingUser.Email != "" {
-		fmt.Print("User with email already existsl")
-		return helper.NewErrorResponse(409, "User with this email already exists", nil)
+	return nil
+}
+
+// MaxBulkCreateUsers is the largest number of users BulkCreate accepts at once.
+const MaxBulkCreateUsers = 1000
+
+// BulkCreate validates and creates users, reporting the outcome for each of
+// them. Users that repeat the email or phone number of an earlier user in the
+// batch are rejected. With atomic, no user is created unless all of them can
+// be; the others are then reported as 424 Failed Dependency.
+func (service *UserServiceImpl) BulkCreate(ctx context.Context, requests []request.UserCreateRequest, atomic bool) (response.BulkCreateResponse, error) {
+	if len(requests) == 0 {
+		return response.BulkCreateResponse{}, helper.NewErrorResponse(400, "No users to create", nil)
+	}
+	if len(requests) > MaxBulkCreateUsers {
+		return response.BulkCreateResponse{}, helper.NewErrorResponse(400, fmt.Sprintf("At most %d users can be created at once", MaxBulkCreateUsers), nil)
 	}
 
-	existingUserByPhoneNumber, err := service.UserRepository.FindByPhoneNumber(ctx, request.PhoneNumber)
-	if err != nil {
-		fmt.Print("Error here we couldnt find by phone num")
-		return err
+	results := make([]response.BulkCreateResult, len(requests))
+	fail := func(i int, err *helper.ErrorResponse) {
+		results[i] = response.BulkCreateResult{Index: i, Status: err.Code, Error: err}
 	}
 
-	if existingUserByPhoneNumber.PhoneNumber != "" {
-		fmt.Print("User with phone already existsl")
-		return helper.NewErrorResponse(409, "User with this phone nubmer already exists", nil)
+	var users []model.User
+	var positions []int
+	batch := newBatchChecker(service.canonicalEmail)
+	for i, userRequest := range requests {
+		if errorResponse := batch.check(userRequest, fmt.Sprintf("User %d in this batch", i)); errorResponse != nil {
+			fail(i, errorResponse)
+			continue
+		}
+
+		users = append(users, newUser(userRequest))
+		positions = append(positions, i)
 	}
 
-	user := model.User{
-		Name:        request.Name,
-		Surname:     request.Surname,
-		Email:       request.Email,
-		PhoneNumber: request.PhoneNumber,
-		CreatedAt:  time.Now(),
+	var saved []repository.SaveResult
+	if len(users) > 0 && !(atomic && len(users) < len(requests)) {
+		var err error
+		saved, err = service.UserRepository.SaveAll(ctx, users, atomic)
+		if err != nil {
+			return response.BulkCreateResponse{}, helper.NewInternalErrorResponse(err, "Failed to save users")
+		}
 	}
 
-	if err := service.UserRepository.Save(ctx, user); err != nil {
-		return helper.NewErrorResponse(500, "Failed to save user", nil)
+	rolledBack := atomic && len(users) < len(requests)
+	for _, result := range saved {
+		rolledBack = rolledBack || (atomic && result.Err != nil)
 	}
 
+	for j, i := range positions {
+		var err error
+		if saved != nil {
+			err = saved[j].Err
+		}
+
+		switch {
+		case err != nil:
+			log.Printf("Failed to save user %d of batch: %v", i, err)
+			fail(i, saveErrorResponse(err))
+		case rolledBack:
+			fail(i, helper.NewErrorResponse(424, "Not created because another user in the batch failed", nil))
+		default:
+			id := saved[j].Id
+			results[i] = response.BulkCreateResult{Index: i, Status: 201, Id: &id}
+		}
+	}
+
+	bulkResponse := response.BulkCreateResponse{Results: results}
+	for _, result := range results {
+		if result.Id != nil {
+			bulkResponse.Created++
+		} else {
+			bulkResponse.Failed++
+		}
+	}
+
+	return bulkResponse, nil
+}
+
+// batchChecker validates the users of a batch and rejects those that repeat
+// the email or phone number of an earlier user in it. Emails are compared by
+// canonicalEmail, as the repository compares them.
+type batchChecker struct {
+	canonicalEmail func(email string) (string, error)
+	emails         map[string]string
+	phoneNumbers   map[string]string
+}
+
+func newBatchChecker(canonicalEmail func(email string) (string, error)) *batchChecker {
+	return &batchChecker{canonicalEmail: canonicalEmail, emails: map[string]string{}, phoneNumbers: map[string]string{}}
+}
+
+// canonicalEmail returns the form of email the repository tells users apart
+// by, or email itself if the repository compares emails as they are.
+func (service *UserServiceImpl) canonicalEmail(email string) (string, error) {
+	if canonicalizer, ok := service.UserRepository.(repository.EmailCanonicalizer); ok {
+		return canonicalizer.CanonicalEmail(email)
+	}
+	return email, nil
+}
+
+// check returns why userRequest cannot be created, or nil. label names the
+// user in messages about later duplicates of it.
+func (batch *batchChecker) check(userRequest request.UserCreateRequest, label string) *helper.ErrorResponse {
+	if err := helper.ValidateStruct(userRequest); err != nil {
+		var errorResponse *helper.ErrorResponse
+		if !errors.As(err, &errorResponse) {
+			errorResponse = helper.NewInternalErrorResponse(err, "Failed to validate user")
+		}
+		return errorResponse
+	}
+	email, err := batch.canonicalEmail(userRequest.Email)
+	if err != nil {
+		return saveErrorResponse(err)
+	}
+	if first, ok := batch.emails[email]; ok {
+		return helper.NewErrorResponse(409, fmt.Sprintf("%s has the same email", first), nil)
+	}
+	if first, ok := batch.phoneNumbers[userRequest.PhoneNumber]; ok {
+		return helper.NewErrorResponse(409, fmt.Sprintf("%s has the same phone number", first), nil)
+	}
+
+	batch.emails[email] = label
+	batch.phoneNumbers[userRequest.PhoneNumber] = label
 	return nil
 }
 
-func (service *UserServiceImpl) Delete(ctx context.Context, userId uuid.UUID) error {
+func newUser(userRequest request.UserCreateRequest) model.User {
+	return model.User{
+		Name:        userRequest.Name,
+		Surname:     userRequest.Surname,
+		Email:       userRequest.Email,
+		PhoneNumber: userRequest.PhoneNumber,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// saveErrorResponse maps an error from saving a user to its response.
+func saveErrorResponse(err error) *helper.ErrorResponse {
+	switch {
+	case errors.Is(err, repository.ErrDuplicateEmail):
+		return helper.NewErrorResponse(409, "User with this email already exists", nil)
+	case errors.Is(err, repository.ErrDuplicatePhoneNumber):
+		return helper.NewErrorResponse(409, "User with this phone number already exists", nil)
+	case errors.Is(err, helper.ErrInvalidEmail):
+		return helper.NewErrorResponse(400, "Email is not a valid address", nil)
+	default:
+		return helper.NewInternalErrorResponse(err, "Failed to save user")
+	}
+}
+
+func (service *UserServiceImpl) Delete(ctx context.Context, userId uuid.UUID, version int64) error {
 	user, err := service.UserRepository.FindById(ctx, userId)
-	if err != nil {
+	if errors.Is(err, repository.ErrNotFound) {
 		return helper.NewErrorResponse(404, fmt.Sprintf("User with id %s not found", userId), nil)
 	}
+	if err != nil {
+		return helper.NewInternalErrorResponse(err, "Failed to find user")
+	}
 
-	err = service.UserRepository.Delete(ctx, user.Id)
+	if version != 0 && version != user.Version {
+		return newPreconditionFailedResponse()
+	}
+
+	err = service.UserRepository.Delete(ctx, user.Id, user.Version)
+	var conflict *repository.VersionConflictError
+	if errors.As(err, &conflict) {
+		return newPreconditionFailedResponse()
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return helper.NewErrorResponse(404, fmt.Sprintf("User with id %s not found", userId), nil)
+	}
 	if err != nil {
-		return helper.NewErrorResponse(500, "Failed to delete user", nil)
+		return helper.NewInternalErrorResponse(err, "Failed to delete user")
 	}
 
 	return nil
 }
 
-func (service *UserServiceImpl) FindAll(ctx context.Context) ([]response.UserResponse, error) {
-	users, err := service.UserRepository.FindAll(ctx)
+func (service *UserServiceImpl) Restore(ctx context.Context, userId uuid.UUID) (response.UserResponse, error) {
+	err := service.UserRepository.Restore(ctx, userId)
+	switch {
+	case errors.Is(err, repository.ErrUserNotDeleted):
+		return response.UserResponse{}, helper.NewErrorResponse(404, fmt.Sprintf("Deleted user with id %s not found", userId), nil)
+	case errors.Is(err, repository.ErrRestoreConflict):
+		return response.UserResponse{}, helper.NewErrorResponse(409, "Another user already has this email or phone number", nil)
+	case err != nil:
+		return response.UserResponse{}, helper.NewInternalErrorResponse(err, "Failed to restore user")
+	}
+
+	return service.FindById(ctx, userId)
+}
+
+const DefaultPageLimit = 20
+
+func (service *UserServiceImpl) FindAll(ctx context.Context, request request.UserListRequest) (response.UserPageResponse, error) {
+	err := helper.ValidateStruct(request)
+	if err != nil {
+		return response.UserPageResponse{}, err
+	}
+
+	sort, err := repository.ParseSort(request.Sort)
 	if err != nil {
-		return nil, helper.NewErrorResponse(500, "Failed to retrieve users", nil)
+		return response.UserPageResponse{}, helper.NewErrorResponse(400, "Invalid sort parameter", []helper.ValidationError{
+			{Field: "sort", Tag: "sort", Message: err.Error()},
+		})
+	}
+
+	query := repository.UserQuery{
+		Filter: repository.UserFilter{
+			Name:        request.Name,
+			Surname:     request.Surname,
+			EmailDomain: request.EmailDomain,
+			CreatedFrom: request.CreatedFrom,
+			CreatedTo:   request.CreatedTo,
+
+			UpdatedSince: request.UpdatedSince,
+
+			IncludeDeleted: request.IncludeDeleted,
+		},
+		Sort:   sort,
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultPageLimit
 	}
 
-	if len(users) == 0 {
-		return nil, helper.NewErrorResponse(404, "No users found", nil)
+	if request.Cursor != "" {
+		query.Cursor, err = repository.DecodeCursor(request.Cursor)
+		if err != nil {
+			return response.UserPageResponse{}, helper.NewErrorResponse(400, "Invalid cursor", nil)
+		}
+	}
+
+	page, err := service.UserRepository.FindPage(ctx, query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return response.UserPageResponse{}, helper.NewErrorResponse(400, "Invalid cursor", nil)
+		}
+		return response.UserPageResponse{}, helper.NewInternalErrorResponse(err, "Failed to retrieve users")
 	}
 
-	var userResponses []response.UserResponse
-	for _, user := range users {
+	userResponses := []response.UserResponse{}
+	for _, user := range page.Users {
 		userResponse := response.UserResponse{
 			Id:          user.Id,
 			Name:        user.Name,
@@ -97,18 +298,78 @@ func (service *UserServiceImpl) FindAll(ctx context.Context) ([]response.UserRes
 			Email:       user.Email,
 			PhoneNumber: user.PhoneNumber,
 			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			DeletedAt:   user.DeletedAt,
+			Version:     user.Version,
 		}
 		userResponses = append(userResponses, userResponse)
 	}
 
-	return userResponses, nil
+	return response.UserPageResponse{
+		Users: userResponses,
+		Pagination: response.Pagination{
+			Total:      page.Total,
+			Limit:      query.Limit,
+			Offset:     query.Offset,
+			NextCursor: page.NextCursor,
+			PrevCursor: page.PrevCursor,
+		},
+	}, nil
+}
+
+func (service *UserServiceImpl) Search(ctx context.Context, request request.UserSearchRequest) (response.UserPageResponse, error) {
+	err := helper.ValidateStruct(request)
+	if err != nil {
+		return response.UserPageResponse{}, err
+	}
+
+	page := repository.Page{Limit: request.Limit, Offset: request.Offset}
+	if page.Limit == 0 {
+		page.Limit = DefaultPageLimit
+	}
+
+	searchPage, err := service.UserRepository.Search(ctx, request.Query, page)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidSearchQuery) {
+			return response.UserPageResponse{}, helper.NewErrorResponse(400, "Search query must contain letters or digits", nil)
+		}
+		return response.UserPageResponse{}, helper.NewInternalErrorResponse(err, "Failed to search users")
+	}
+
+	userResponses := []response.UserResponse{}
+	for _, result := range searchPage.Results {
+		userResponse := response.UserResponse{
+			Id:          result.User.Id,
+			Name:        result.User.Name,
+			Surname:     result.User.Surname,
+			Email:       result.User.Email,
+			PhoneNumber: result.User.PhoneNumber,
+			CreatedAt:   result.User.CreatedAt,
+			UpdatedAt:   result.User.UpdatedAt,
+			Version:     result.User.Version,
+			Snippet:     result.Snippet,
+		}
+		userResponses = append(userResponses, userResponse)
+	}
+
+	return response.UserPageResponse{
+		Users: userResponses,
+		Pagination: response.Pagination{
+			Total:  searchPage.Total,
+			Limit:  page.Limit,
+			Offset: page.Offset,
+		},
+	}, nil
 }
 
 func (service *UserServiceImpl) FindById(ctx context.Context, userId uuid.UUID) (response.UserResponse, error) {
 	user, err := service.UserRepository.FindById(ctx, userId)
-	if err != nil {
+	if errors.Is(err, repository.ErrNotFound) {
 		return response.UserResponse{}, helper.NewErrorResponse(404, "User not found", nil)
 	}
+	if err != nil {
+		return response.UserResponse{}, helper.NewInternalErrorResponse(err, "Failed to find user")
+	}
 
 	userResponse := response.UserResponse{
 		Id:          user.Id,
@@ -117,6 +378,8 @@ func (service *UserServiceImpl) FindById(ctx context.Context, userId uuid.UUID)
 		Email:       user.Email,
 		PhoneNumber: user.PhoneNumber,
 		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Version:     user.Version,
 	}
 
 	return userResponse, nil
@@ -128,34 +391,15 @@ func (service *UserServiceImpl) Update(ctx context.Context, request request.User
 		return response.UserResponse{}, err
 	}
 
-	user, err := service.UserRepository.FindById(ctx, request.Id)
+	user, err := service.findForUpdate(ctx, userId, request.Version)
 	if err != nil {
-		return response.UserResponse{}, helper.NewErrorResponse(404, "User with given id not found", nil)
+		return response.UserResponse{}, err
 	}
 
 	if request.Name == "" && request.Surname == "" && request.Email == "" && request.PhoneNumber == "" {
 		return response.UserResponse{}, helper.NewErrorResponse(400, "No fields to update", nil) 
 	}
 
-	existingUser, err := service.UserRepository.FindByEmail(ctx, request.Email)
-
-	if err != nil {
-		return response.UserResponse{}, err
-	}
-
-	if existingUser.Email != "" {
-		return response.UserResponse{}, helper.NewErrorResponse(409, "User with email already exists", nil)
-	}
-
-	existingUserByPhoneNumber, err := service.UserRepository.FindByPhoneNumber(ctx, request.PhoneNumber)
-	if err != nil {
-		return response.UserResponse{}, err
-	}
-
-	if existingUserByPhoneNumber.PhoneNumber != "" {
-		return response.UserResponse{}, helper.NewErrorResponse(409, "User with this phone nubmer already exists", nil)
-	}
-
 	if request.Name != "" {
 		user.Name = request.Name
 	}
@@ -169,20 +413,172 @@ func (service *UserServiceImpl) Update(ctx context.Context, request request.User
 		user.PhoneNumber = request.PhoneNumber
 	}
 
-	err = service.UserRepository.Update(ctx, request.Id, user)
+	return service.update(ctx, userId, user)
+}
 
+// Patch applies a JSON merge patch or JSON patch to the user's name, surname,
+// email and phone number as they are now, and saves the result if it passes
+// the same validation as a new user. Unlike Update, a patch can clear a
+// field, which then fails validation if the field is required.
+func (service *UserServiceImpl) Patch(ctx context.Context, userId uuid.UUID, patchRequest request.UserPatchRequest) (response.UserResponse, error) {
+	user, err := service.findForUpdate(ctx, userId, patchRequest.Version)
 	if err != nil {
-		return response.UserResponse{}, helper.NewErrorResponse(500, "Failed to update user", nil)
+		return response.UserResponse{}, err
 	}
 
-	userResponse := response.UserResponse{
-		Id:          user.Id,
+	document, err := json.Marshal(request.UserPatchDocument{
 		Name:        user.Name,
 		Surname:     user.Surname,
 		Email:       user.Email,
 		PhoneNumber: user.PhoneNumber,
-		CreatedAt:   user.CreatedAt,
+	})
+	if err != nil {
+		return response.UserResponse{}, helper.NewInternalErrorResponse(err, "Failed to patch user")
 	}
 
-	return userResponse, nil
-}
\ No newline at end of file
+	var patched []byte
+	switch patchRequest.ContentType {
+	case helper.MergePatchContentType:
+		patched, err = helper.ApplyMergePatch(document, patchRequest.Patch)
+	case helper.JSONPatchContentType:
+		patched, err = helper.ApplyJSONPatch(document, patchRequest.Patch)
+	default:
+		return response.UserResponse{}, helper.NewErrorResponse(415, fmt.Sprintf("Patch type %q is not supported", patchRequest.ContentType), nil)
+	}
+	switch {
+	case errors.Is(err, helper.ErrPatchTestFailed):
+		return response.UserResponse{}, helper.NewErrorResponse(409, "Patch test operation failed", patchErrors(err))
+	case errors.Is(err, helper.ErrInvalidPatch):
+		return response.UserResponse{}, helper.NewErrorResponse(400, "Invalid patch", patchErrors(err))
+	case err != nil:
+		return response.UserResponse{}, helper.NewInternalErrorResponse(err, "Failed to patch user")
+	}
+
+	// The patched document must still be a user: members it does not have,
+	// or values of the wrong type, are rejected rather than ignored.
+	patchedUser := request.UserPatchDocument{}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patchedUser); err != nil {
+		return response.UserResponse{}, helper.NewErrorResponse(400, "Patched user is not a valid user", patchErrors(err))
+	}
+	if err := helper.ValidateStruct(patchedUser); err != nil {
+		return response.UserResponse{}, err
+	}
+
+	user.Name = patchedUser.Name
+	user.Surname = patchedUser.Surname
+	user.Email = patchedUser.Email
+	user.PhoneNumber = patchedUser.PhoneNumber
+
+	return service.update(ctx, userId, user)
+}
+
+func patchErrors(err error) []helper.ValidationError {
+	return []helper.ValidationError{{Field: "patch", Tag: "patch", Message: err.Error()}}
+}
+
+// Replace sets every mutable field of the user with userId, or creates the
+// user under that id when there is none, and reports whether it was created.
+// Replacing a user with what it already has changes nothing, so a replace can
+// safely be repeated.
+func (service *UserServiceImpl) Replace(ctx context.Context, userId uuid.UUID, replaceRequest request.UserReplaceRequest) (response.UserResponse, bool, error) {
+	err := helper.ValidateStruct(replaceRequest)
+	if err != nil {
+		return response.UserResponse{}, false, err
+	}
+
+	// A concurrent replace may create the user between the lookup and the
+	// save; the second attempt then replaces it instead.
+	for attempt := 0; ; attempt++ {
+		user, err := service.UserRepository.FindById(ctx, userId)
+		if errors.Is(err, repository.ErrNotFound) {
+			if replaceRequest.Version != 0 || replaceRequest.MustExist {
+				return response.UserResponse{}, false, newPreconditionFailedResponse()
+			}
+
+			err := service.UserRepository.Save(ctx, model.User{
+				Id:          userId,
+				Name:        replaceRequest.Name,
+				Surname:     replaceRequest.Surname,
+				Email:       replaceRequest.Email,
+				PhoneNumber: replaceRequest.PhoneNumber,
+				CreatedAt:   time.Now(),
+			})
+			if errors.Is(err, repository.ErrDuplicateId) {
+				if attempt == 0 {
+					continue
+				}
+				return response.UserResponse{}, false, helper.NewErrorResponse(409, "A deleted user has this id; restore it before replacing it", nil)
+			}
+			if err != nil {
+				return response.UserResponse{}, false, saveErrorResponse(err)
+			}
+
+			created, err := service.FindById(ctx, userId)
+			return created, true, err
+		}
+		if err != nil {
+			return response.UserResponse{}, false, helper.NewInternalErrorResponse(err, "Failed to find user")
+		}
+
+		if replaceRequest.Version != 0 && replaceRequest.Version != user.Version {
+			return response.UserResponse{}, false, newPreconditionFailedResponse()
+		}
+		if user.Name == replaceRequest.Name && user.Surname == replaceRequest.Surname && user.Email == replaceRequest.Email && user.PhoneNumber == replaceRequest.PhoneNumber {
+			unchanged, err := service.FindById(ctx, userId)
+			return unchanged, false, err
+		}
+		if replaceRequest.RequireVersion && replaceRequest.Version == 0 {
+			return response.UserResponse{}, false, helper.NewErrorResponse(428, "If-Match header with the user's ETag is required to replace an existing user", nil)
+		}
+
+		user.Name = replaceRequest.Name
+		user.Surname = replaceRequest.Surname
+		user.Email = replaceRequest.Email
+		user.PhoneNumber = replaceRequest.PhoneNumber
+
+		replaced, err := service.update(ctx, userId, user)
+		return replaced, false, err
+	}
+}
+
+// findForUpdate returns the user to change, checking that it is still at
+// version unless version is zero.
+func (service *UserServiceImpl) findForUpdate(ctx context.Context, userId uuid.UUID, version int64) (model.User, error) {
+	user, err := service.UserRepository.FindById(ctx, userId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return model.User{}, helper.NewErrorResponse(404, "User with given id not found", nil)
+	}
+	if err != nil {
+		return model.User{}, helper.NewInternalErrorResponse(err, "Failed to find user")
+	}
+
+	if version != 0 && version != user.Version {
+		return model.User{}, newPreconditionFailedResponse()
+	}
+
+	return user, nil
+}
+
+// update saves the changed user and returns it as it is now. The user keeps
+// the version it was read at, so a concurrent change is reported as 412.
+func (service *UserServiceImpl) update(ctx context.Context, userId uuid.UUID, user model.User) (response.UserResponse, error) {
+	err := service.UserRepository.Update(ctx, userId, user)
+	var conflict *repository.VersionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return response.UserResponse{}, newPreconditionFailedResponse()
+	case errors.Is(err, repository.ErrNotFound):
+		return response.UserResponse{}, helper.NewErrorResponse(404, "User with given id not found", nil)
+	case errors.Is(err, repository.ErrDuplicateEmail), errors.Is(err, repository.ErrDuplicatePhoneNumber), errors.Is(err, helper.ErrInvalidEmail):
+		return response.UserResponse{}, saveErrorResponse(err)
+	case err != nil:
+		return response.UserResponse{}, helper.NewInternalErrorResponse(err, "Failed to update user")
+	}
+
+	return service.FindById(ctx, userId)
+}
+func newPreconditionFailedResponse() *helper.ErrorResponse {
+	return helper.NewErrorResponse(412, "User was modified since it was read; fetch it again and retry", nil)
+}
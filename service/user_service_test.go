@@ -2,9 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 	"user-crud/data/request"
+	"user-crud/data/response"
+	"user-crud/helper"
 	"user-crud/model"
+	"user-crud/repository"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -19,11 +26,38 @@ func (m *MockUserRepository) Save(ctx context.Context, user model.User) error {
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) Delete(ctx context.Context, userId uuid.UUID) error {
+func (m *MockUserRepository) SaveAll(ctx context.Context, users []model.User, atomic bool) ([]repository.SaveResult, error) {
+	args := m.Called(ctx, users, atomic)
+	results, _ := args.Get(0).([]repository.SaveResult)
+	return results, args.Error(1)
+}
+
+func (m *MockUserRepository) Export(ctx context.Context, filter repository.UserFilter, fn func(user model.User) error) error {
+	args := m.Called(ctx, filter)
+	users, _ := args.Get(0).([]model.User)
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockUserRepository) Delete(ctx context.Context, userId uuid.UUID, version int64) error {
+	args := m.Called(ctx, userId, version)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Restore(ctx context.Context, userId uuid.UUID) error {
 	args := m.Called(ctx, userId)
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	args := m.Called(ctx, deletedBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockUserRepository) FindById(ctx context.Context, userId uuid.UUID) (model.User, error) {
 	args := m.Called(ctx, userId)
 	return args.Get(0).(model.User), args.Error(1)
@@ -44,6 +78,16 @@ func (m *MockUserRepository) FindAll(ctx context.Context) ([]model.User, error)
 	return args.Get(0).([]model.User), args.Error(1)
 }
 
+func (m *MockUserRepository) FindPage(ctx context.Context, query repository.UserQuery) (repository.UserPage, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(repository.UserPage), args.Error(1)
+}
+
+func (m *MockUserRepository) Search(ctx context.Context, query string, page repository.Page) (repository.SearchPage, error) {
+	args := m.Called(ctx, query, page)
+	return args.Get(0).(repository.SearchPage), args.Error(1)
+}
+
 func (m *MockUserRepository) Update(ctx context.Context, userId uuid.UUID, user model.User) error {
 	args := m.Called(ctx, userId, user)
 	return args.Error(0)
@@ -60,14 +104,244 @@ func TestCreateUser(t *testing.T) {
 		PhoneNumber: "1234567890",
 	}
 
-	mockRepo.On("FindByEmail", mock.Anything, userRequest.Email).Return(model.User{}, nil)
-	mockRepo.On("FindByPhoneNumber", mock.Anything, userRequest.PhoneNumber).Return(model.User{}, nil)
 	mockRepo.On("Save", mock.Anything, mock.Anything).Return(nil)
 
 	err := service.Create(context.Background(), userRequest)
 
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "FindByEmail", mock.Anything, mock.Anything)
+}
+
+func TestCreateUserDuplicate(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	userRequest := request.UserCreateRequest{
+		Name:        "John",
+		Surname:     "Doe",
+		Email:       "john.doe@example.com",
+		PhoneNumber: "1234567890",
+	}
+
+	mockRepo.On("Save", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: UNIQUE constraint failed: users.email", repository.ErrDuplicateEmail)).Once()
+	mockRepo.On("Save", mock.Anything, mock.Anything).Return(errors.New("disk I/O error")).Once()
+
+	err := service.Create(context.Background(), userRequest)
+	var errorResponse *helper.ErrorResponse
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 409, errorResponse.Code)
+	assert.Equal(t, "User with this email already exists", errorResponse.Message)
+
+	err = service.Create(context.Background(), userRequest)
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 500, errorResponse.Code)
+}
+
+func TestBulkCreateUsers(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	requests := []request.UserCreateRequest{
+		{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"},
+		{Name: "Jane", Surname: "Doe", Email: "not-an-email", PhoneNumber: "0987654321"},
+		{Name: "Jack", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "1111111111"},
+		{Name: "Jill", Surname: "Doe", Email: "jill.doe@example.com", PhoneNumber: "2222222222"},
+	}
+
+	id := uuid.New()
+	mockRepo.On("SaveAll", mock.Anything, mock.MatchedBy(func(users []model.User) bool {
+		return len(users) == 2 && users[0].Name == "John" && users[1].Name == "Jill"
+	}), false).Return([]repository.SaveResult{
+		{Id: id},
+		{Id: uuid.New(), Err: repository.ErrDuplicatePhoneNumber},
+	}, nil)
+
+	result, err := service.BulkCreate(context.Background(), requests, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 3, result.Failed)
+
+	var statuses []int
+	for _, item := range result.Results {
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []int{201, 400, 409, 409}, statuses)
+	assert.Equal(t, &id, result.Results[0].Id)
+	assert.Nil(t, result.Results[3].Id)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBulkCreateUsersAtomic(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	requests := []request.UserCreateRequest{
+		{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"},
+		{Name: "Jane", Surname: "Doe", Email: "not-an-email", PhoneNumber: "0987654321"},
+	}
+
+	result, err := service.BulkCreate(context.Background(), requests, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Created)
+	assert.Equal(t, 424, result.Results[0].Status)
+	assert.Equal(t, 400, result.Results[1].Status)
+	mockRepo.AssertNotCalled(t, "SaveAll", mock.Anything, mock.Anything, mock.Anything)
+
+	_, err = service.BulkCreate(context.Background(), nil, true)
+	var errorResponse *helper.ErrorResponse
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 400, errorResponse.Code)
+}
+
+func TestBulkCreateUsersComparesCanonicalEmails(t *testing.T) {
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{GmailDots: true, PlusTags: true})
+	service := NewUserServiceImpl(repo)
+
+	requests := []request.UserCreateRequest{
+		{Name: "John", Surname: "Doe", Email: "John@Example.com", PhoneNumber: "5550000001"},
+		{Name: "John", Surname: "Doe", Email: "john@example.com", PhoneNumber: "5550000002"},
+		{Name: "Jane", Surname: "Doe", Email: "jdoe@gmail.com", PhoneNumber: "5550000003"},
+		{Name: "Jane", Surname: "Doe", Email: "j.doe+x@gmail.com", PhoneNumber: "5550000004"},
+	}
+
+	result, err := service.BulkCreate(context.Background(), requests, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.EqualError(t, result.Results[1].Error, "Code: 409, Message: User 0 in this batch has the same email, Errors: []")
+	assert.EqualError(t, result.Results[3].Error, "Code: 409, Message: User 2 in this batch has the same email, Errors: []")
+}
+
+func TestImportUsers(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	csvFile := "\ufeffName,Surname,Email,Phone_Number,Notes\n" +
+		"John,Doe,john.doe@example.com,1234567890,\n" +
+		"Jane,Doe,not-an-email,0987654321,\n" +
+		"Jack,Doe,john.doe@example.com,1111111111,\n" +
+		"Jill,Doe\n" +
+		"Joe,Doe,joe.doe@example.com,3333333333,vip\n" +
+		"Jim,Doe,jim.doe@example.com,4444444444,\n"
+
+	johnId, jimId := uuid.New(), uuid.New()
+	mockRepo.On("SaveAll", mock.Anything, mock.MatchedBy(func(users []model.User) bool {
+		return len(users) == 2 && users[0].Name == "John" && users[1].Name == "Joe"
+	}), false).Return([]repository.SaveResult{
+		{Id: johnId},
+		{Id: uuid.New(), Err: repository.ErrDuplicatePhoneNumber},
+	}, nil).Once()
+	mockRepo.On("SaveAll", mock.Anything, mock.MatchedBy(func(users []model.User) bool {
+		return len(users) == 1 && users[0].Name == "Jim"
+	}), false).Return([]repository.SaveResult{{Id: jimId}}, nil).Once()
+
+	result, err := service.Import(context.Background(), strings.NewReader(csvFile), request.UserImportRequest{ChunkSize: 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, 4, result.Failed)
+	assert.Equal(t, []string{"notes"}, result.IgnoredColumns)
+	assert.Zero(t, result.StoppedAtLine)
+
+	var lines, statuses []int
+	for _, row := range result.Rows {
+		lines = append(lines, row.Line)
+		statuses = append(statuses, row.Status)
+	}
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7}, lines)
+	assert.Equal(t, []int{201, 400, 409, 400, 409, 201}, statuses)
+	assert.Equal(t, &johnId, result.Rows[0].Id)
+	assert.Equal(t, &jimId, result.Rows[5].Id)
+	assert.EqualError(t, result.Rows[2].Error, "Code: 409, Message: Line 2 has the same email, Errors: []")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestImportUsersDryRun(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	csvFile := "email,phone_number,name,surname\n" +
+		"john.doe@example.com,1234567890,John,Doe\n" +
+		"jane.doe@example.com,0987654321,Jane,Doe\n" +
+		"\"jack.doe@example.com,1111111111,Jack,Doe\n"
+
+	mockRepo.On("FindByEmail", mock.Anything, "john.doe@example.com").Return(model.User{Email: "john.doe@example.com"}, nil)
+	mockRepo.On("FindByEmail", mock.Anything, "jane.doe@example.com").Return(model.User{}, repository.ErrNotFound)
+	mockRepo.On("FindByPhoneNumber", mock.Anything, "0987654321").Return(model.User{}, repository.ErrNotFound)
+
+	result, err := service.Import(context.Background(), strings.NewReader(csvFile), request.UserImportRequest{DryRun: true})
+
+	assert.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 1, result.Created)
+	assert.Len(t, result.Rows, 3)
+	assert.Equal(t, 409, result.Rows[0].Status)
+	assert.Equal(t, 201, result.Rows[1].Status)
+	assert.Nil(t, result.Rows[1].Id)
+	assert.Equal(t, response.ImportRowResult{Line: 4, Status: 400, Error: result.Rows[2].Error}, result.Rows[2])
+	assert.Equal(t, 4, result.StoppedAtLine)
+	mockRepo.AssertNotCalled(t, "SaveAll", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestImportUsersDryRunComparesCanonicalEmails(t *testing.T) {
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{GmailDots: true, PlusTags: true})
+	service := NewUserServiceImpl(repo)
+
+	csvFile := "name,surname,email,phone_number\n" +
+		"John,Doe,John@Example.com,5550000001\n" +
+		"John,Doe,john@example.com,5550000002\n" +
+		"Jane,Doe,jdoe@gmail.com,5550000003\n" +
+		"Jane,Doe,j.doe+x@gmail.com,5550000004\n"
+
+	result, err := service.Import(context.Background(), strings.NewReader(csvFile), request.UserImportRequest{DryRun: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Created, "a dry run must reject what a real import would")
+	var statuses []int
+	for _, row := range result.Rows {
+		statuses = append(statuses, row.Status)
+	}
+	assert.Equal(t, []int{201, 409, 201, 409}, statuses)
+
+	users, err := repo.FindAll(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestImportUsersDryRunReportsInvalidEmail(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	csvFile := "name,surname,email,phone_number\n" +
+		"John,Doe,john.doe@bad--domain.example,1234567890\n"
+
+	mockRepo.On("FindByEmail", mock.Anything, "john.doe@bad--domain.example").Return(model.User{}, fmt.Errorf("%w: bad domain", helper.ErrInvalidEmail))
+
+	result, err := service.Import(context.Background(), strings.NewReader(csvFile), request.UserImportRequest{DryRun: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Created)
+	if assert.Len(t, result.Rows, 1) {
+		assert.Equal(t, 400, result.Rows[0].Status, "a real import would reject the email")
+	}
+	mockRepo.AssertNotCalled(t, "FindByPhoneNumber", mock.Anything, mock.Anything)
+}
+
+func TestImportUsersRejectsInvalidHeader(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	for _, csvFile := range []string{"", "name,surname,email\n", "name,surname,email,phone_number,Email\n"} {
+		_, err := service.Import(context.Background(), strings.NewReader(csvFile), request.UserImportRequest{})
+
+		var errorResponse *helper.ErrorResponse
+		assert.ErrorAs(t, err, &errorResponse, csvFile)
+		assert.Equal(t, 400, errorResponse.Code, csvFile)
+	}
 }
 
 func TestDeleteUser(t *testing.T) {
@@ -75,17 +349,32 @@ func TestDeleteUser(t *testing.T) {
 	service := NewUserServiceImpl(mockRepo)
 
 	userId := uuid.New()
-	user := model.User{Id: userId}
+	user := model.User{Id: userId, Version: 2}
 
 	mockRepo.On("FindById", mock.Anything, userId).Return(user, nil)
-	mockRepo.On("Delete", mock.Anything, userId).Return(nil)
+	mockRepo.On("Delete", mock.Anything, userId, int64(2)).Return(nil)
 
-	err := service.Delete(context.Background(), userId)
+	err := service.Delete(context.Background(), userId, 0)
 
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestDeleteUserVersionMismatch(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	userId := uuid.New()
+	mockRepo.On("FindById", mock.Anything, userId).Return(model.User{Id: userId, Version: 3}, nil)
+
+	err := service.Delete(context.Background(), userId, 2)
+
+	var errorResponse *helper.ErrorResponse
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 412, errorResponse.Code)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestFindAllUsers(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserServiceImpl(mockRepo)
@@ -96,17 +385,50 @@ func TestFindAllUsers(t *testing.T) {
 	}
 
 
-	mockRepo.On("FindAll", mock.Anything).Return(users, nil)
+	sort, _ := repository.ParseSort("-name")
+	query := repository.UserQuery{
+		Filter: repository.UserFilter{EmailDomain: "example.com"},
+		Sort:   sort,
+		Limit:  DefaultPageLimit,
+	}
+	mockRepo.On("FindPage", mock.Anything, query).Return(repository.UserPage{Users: users, Total: 3, NextCursor: "next"}, nil)
 
 
-	result, err := service.FindAll(context.Background())
+	result, err := service.FindAll(context.Background(), request.UserListRequest{Sort: "-name", EmailDomain: "example.com"})
 
 
 	assert.NoError(t, err)
-	assert.Len(t, result, 2)
+	assert.Len(t, result.Users, 2)
+	assert.Equal(t, 3, result.Pagination.Total)
+	assert.Equal(t, DefaultPageLimit, result.Pagination.Limit)
+	assert.Equal(t, "next", result.Pagination.NextCursor)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestFindAllUsersRejectsInvalidParameters(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	cursor := repository.EncodeCursor(repository.Cursor{Sort: "name", Values: []string{"John"}, Id: uuid.NewString()})
+	requests := map[string]request.UserListRequest{
+		"unknown sort field": {Sort: "password"},
+		"limit too large":    {Limit: 1000},
+		"cursor and offset":  {Cursor: cursor, Offset: 10},
+		"malformed cursor":   {Cursor: "not a cursor"},
+	}
+
+	for name, listRequest := range requests {
+		t.Run(name, func(t *testing.T) {
+			_, err := service.FindAll(context.Background(), listRequest)
+
+			var errorResponse *helper.ErrorResponse
+			assert.ErrorAs(t, err, &errorResponse)
+			assert.Equal(t, 400, errorResponse.Code)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "FindPage", mock.Anything, mock.Anything)
+}
+
 func TestFindByIdUser(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserServiceImpl(mockRepo)
@@ -132,7 +454,6 @@ func TestUpdateUser(t *testing.T) {
 
 	userId := uuid.New()
 	userRequest := request.UserUpdateRequest{
-		Id:          userId,
 		Name:        "Updated Name",
 		Surname:     "Updated Surname",
 		Email:       "updated.email@example.com",
@@ -140,11 +461,13 @@ func TestUpdateUser(t *testing.T) {
 	}
 
 
-	user := model.User{Id: userId, Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
-	mockRepo.On("FindById", mock.Anything, userId).Return(user, nil)
-	mockRepo.On("FindByEmail", mock.Anything, userRequest.Email).Return(model.User{}, nil)
-	mockRepo.On("FindByPhoneNumber", mock.Anything, userRequest.PhoneNumber).Return(model.User{}, nil)
-	mockRepo.On("Update", mock.Anything, userId, mock.Anything).Return(nil)
+	user := model.User{Id: userId, Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890", Version: 1}
+	updated := model.User{Id: userId, Name: userRequest.Name, Surname: userRequest.Surname, Email: userRequest.Email, PhoneNumber: userRequest.PhoneNumber, UpdatedAt: time.Now(), Version: 2}
+	mockRepo.On("FindById", mock.Anything, userId).Return(user, nil).Once()
+	mockRepo.On("Update", mock.Anything, userId, mock.MatchedBy(func(user model.User) bool {
+		return user.Name == userRequest.Name && user.Email == userRequest.Email && user.Version == 1
+	})).Return(nil)
+	mockRepo.On("FindById", mock.Anything, userId).Return(updated, nil).Once()
 
 
 	result, err := service.Update(context.Background(), userRequest, userId)
@@ -154,5 +477,341 @@ func TestUpdateUser(t *testing.T) {
 	assert.Equal(t, userRequest.Name, result.Name)
 	assert.Equal(t, userRequest.Email, result.Email)
 	assert.Equal(t, userRequest.PhoneNumber, result.PhoneNumber)
+	assert.Equal(t, updated.UpdatedAt, result.UpdatedAt)
+	assert.Equal(t, int64(2), result.Version)
 	mockRepo.AssertExpectations(t)
-}
\ No newline at end of file
+}
+
+func TestUpdateUserConcurrentModification(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	userId := uuid.New()
+	userRequest := request.UserUpdateRequest{Name: "Updated Name", Version: 1}
+
+	mockRepo.On("FindById", mock.Anything, userId).Return(model.User{Id: userId, Name: "John", Version: 1}, nil)
+	mockRepo.On("Update", mock.Anything, userId, mock.Anything).Return(&repository.VersionConflictError{UserId: userId, Expected: 1, Current: 2})
+
+	_, err := service.Update(context.Background(), userRequest, userId)
+
+	var errorResponse *helper.ErrorResponse
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 412, errorResponse.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateUserErrors(t *testing.T) {
+	userId := uuid.New()
+
+	tests := []struct {
+		name      string
+		findErr   error
+		updateErr error
+		code      int
+	}{
+		{"not found", fmt.Errorf("%w: %s", repository.ErrNotFound, userId), nil, 404},
+		{"lookup failed", errors.New("disk I/O error"), nil, 500},
+		{"deleted meanwhile", nil, fmt.Errorf("%w: %s", repository.ErrNotFound, userId), 404},
+		{"duplicate phone number", nil, fmt.Errorf("%w: UNIQUE constraint failed: users.phone_number", repository.ErrDuplicatePhoneNumber), 409},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewUserServiceImpl(mockRepo)
+
+			mockRepo.On("FindById", mock.Anything, userId).Return(model.User{Id: userId, Name: "John", Version: 1}, tt.findErr)
+			mockRepo.On("Update", mock.Anything, userId, mock.Anything).Return(tt.updateErr)
+
+			_, err := service.Update(context.Background(), request.UserUpdateRequest{PhoneNumber: "1231231234"}, userId)
+
+			var errorResponse *helper.ErrorResponse
+			assert.ErrorAs(t, err, &errorResponse)
+			assert.Equal(t, tt.code, errorResponse.Code)
+		})
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	results := []repository.SearchResult{
+		{User: model.User{Id: uuid.New(), Name: "John", Surname: "Doe"}, Snippet: "<mark>Jo</mark>hn"},
+	}
+	mockRepo.On("Search", mock.Anything, "jo", repository.Page{Limit: DefaultPageLimit}).Return(repository.SearchPage{Results: results, Total: 1}, nil)
+	mockRepo.On("Search", mock.Anything, "!!", mock.Anything).Return(repository.SearchPage{}, repository.ErrInvalidSearchQuery)
+
+	result, err := service.Search(context.Background(), request.UserSearchRequest{Query: "jo"})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Users, 1)
+	assert.Equal(t, "<mark>Jo</mark>hn", result.Users[0].Snippet)
+	assert.Equal(t, 1, result.Pagination.Total)
+
+	_, err = service.Search(context.Background(), request.UserSearchRequest{Query: "!!"})
+
+	var errorResponse *helper.ErrorResponse
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 400, errorResponse.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRestoreUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	restoredId, missingId, conflictId := uuid.New(), uuid.New(), uuid.New()
+	mockRepo.On("Restore", mock.Anything, restoredId).Return(nil)
+	mockRepo.On("FindById", mock.Anything, restoredId).Return(model.User{Id: restoredId, Name: "John"}, nil)
+	mockRepo.On("Restore", mock.Anything, missingId).Return(repository.ErrUserNotDeleted)
+	mockRepo.On("Restore", mock.Anything, conflictId).Return(repository.ErrRestoreConflict)
+
+	result, err := service.Restore(context.Background(), restoredId)
+	assert.NoError(t, err)
+	assert.Equal(t, restoredId, result.Id)
+
+	var errorResponse *helper.ErrorResponse
+	_, err = service.Restore(context.Background(), missingId)
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 404, errorResponse.Code)
+
+	_, err = service.Restore(context.Background(), conflictId)
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 409, errorResponse.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPurgerUsesRetention(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	purger := NewPurger(mockRepo, 24*time.Hour, time.Hour)
+
+	mockRepo.On("Purge", mock.Anything, mock.MatchedBy(func(deletedBefore time.Time) bool {
+		return time.Since(deletedBefore) >= 24*time.Hour && time.Since(deletedBefore) < 25*time.Hour
+	})).Return(int64(3), nil)
+
+	purged, err := purger.PurgeOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestExportUsers(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	users := []model.User{
+		{Id: uuid.New(), Name: "John", Surname: "Doe, Jr.", Email: "john.doe@example.com", CreatedAt: createdAt},
+		{Id: uuid.New(), Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", CreatedAt: createdAt},
+	}
+	mockRepo.On("Export", mock.Anything, repository.UserFilter{EmailDomain: "example.com"}).Return(users, nil)
+
+	var csvOutput strings.Builder
+	err := service.Export(context.Background(), request.UserExportRequest{Format: ExportFormatCSV, Columns: []string{"surname", "email"}, EmailDomain: "example.com"}, &csvOutput)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "surname,email\n\"Doe, Jr.\",john.doe@example.com\nDoe,jane.doe@example.com\n", csvOutput.String())
+
+	var ndjsonOutput strings.Builder
+	err = service.Export(context.Background(), request.UserExportRequest{Format: ExportFormatNDJSON, Columns: []string{"name", "created_at"}, EmailDomain: "example.com"}, &ndjsonOutput)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"John","created_at":"2025-01-02T03:04:05Z"}`+"\n"+`{"name":"Jane","created_at":"2025-01-02T03:04:05Z"}`+"\n", ndjsonOutput.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestExportUsersEscapesFormulasInCSV(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	users := []model.User{
+		{Name: "=HYPERLINK(\"http://evil.example\")", Surname: "@SUM(A1)", Email: "-1+1@example.com", PhoneNumber: "+905551234567"},
+		{Name: "\tTab", Surname: "\rReturn", Email: "john@example.com", PhoneNumber: "5551234567"},
+	}
+	mockRepo.On("Export", mock.Anything, repository.UserFilter{}).Return(users, nil)
+	columns := []string{"name", "surname", "email", "phone_number"}
+
+	var csvOutput strings.Builder
+	err := service.Export(context.Background(), request.UserExportRequest{Format: ExportFormatCSV, Columns: columns}, &csvOutput)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "name,surname,email,phone_number\n"+
+		"\"'=HYPERLINK(\"\"http://evil.example\"\")\",'@SUM(A1),'-1+1@example.com,'+905551234567\n"+
+		"'\tTab,\"'\rReturn\",john@example.com,5551234567\n", csvOutput.String())
+
+	var ndjsonOutput strings.Builder
+	err = service.Export(context.Background(), request.UserExportRequest{Format: ExportFormatNDJSON, Columns: []string{"name"}}, &ndjsonOutput)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ndjsonOutput.String(), `{"name":"=HYPERLINK`), "NDJSON is not for spreadsheets and is left as is")
+}
+
+func TestExportUsersRejectsInvalidRequest(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceImpl(mockRepo)
+
+	for _, exportRequest := range []request.UserExportRequest{
+		{Format: "xml"},
+		{Columns: []string{"password"}},
+		{Columns: []string{"email", "email"}},
+	} {
+		var output strings.Builder
+		err := service.Export(context.Background(), exportRequest, &output)
+
+		var errorResponse *helper.ErrorResponse
+		assert.ErrorAs(t, err, &errorResponse)
+		assert.Equal(t, 400, errorResponse.Code)
+		assert.Empty(t, output.String())
+	}
+	mockRepo.AssertNotCalled(t, "Export", mock.Anything, mock.Anything)
+}
+
+func TestPatchUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		code        int
+		expected    response.UserResponse
+	}{
+		{"merge patch clears required field", helper.MergePatchContentType, `{"name":"Jane","surname":null}`, 400, response.UserResponse{}},
+		{"merge patch keeps own email", helper.MergePatchContentType, `{"name":"Jane","email":"john.doe@example.com"}`, 0, response.UserResponse{Name: "Jane", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001"}},
+		{"merge patch takes other email", helper.MergePatchContentType, `{"email":"jane.doe@example.com"}`, 409, response.UserResponse{}},
+		{"json patch", helper.JSONPatchContentType, `[{"op":"test","path":"/email","value":"john.doe@example.com"},{"op":"replace","path":"/phone_number","value":"5550000009"}]`, 0, response.UserResponse{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000009"}},
+		{"json patch test fails", helper.JSONPatchContentType, `[{"op":"test","path":"/name","value":"Jane"},{"op":"replace","path":"/name","value":"Joan"}]`, 409, response.UserResponse{}},
+		{"json patch removes required field", helper.JSONPatchContentType, `[{"op":"remove","path":"/phone_number"}]`, 400, response.UserResponse{}},
+		{"unknown member", helper.MergePatchContentType, `{"nickname":"Johnny"}`, 400, response.UserResponse{}},
+		{"wrong type", helper.MergePatchContentType, `{"name":42}`, 400, response.UserResponse{}},
+		{"invalid patch", helper.JSONPatchContentType, `[{"op":"remove","path":"/id"}]`, 400, response.UserResponse{}},
+		{"unsupported type", "application/xml", `<user/>`, 415, response.UserResponse{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+			assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+			assert.NoError(t, repo.Save(ctx, model.User{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()}))
+			john, err := repo.FindByEmail(ctx, "john.doe@example.com")
+			assert.NoError(t, err)
+			service := NewUserServiceImpl(repo)
+
+			result, err := service.Patch(ctx, john.Id, request.UserPatchRequest{ContentType: tt.contentType, Patch: []byte(tt.patch), Version: john.Version})
+
+			if tt.code != 0 {
+				var errorResponse *helper.ErrorResponse
+				assert.ErrorAs(t, err, &errorResponse)
+				assert.Equal(t, tt.code, errorResponse.Code)
+				unchanged, err := repo.FindById(ctx, john.Id)
+				assert.NoError(t, err)
+				assert.Equal(t, john.Version, unchanged.Version)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.Name, result.Name)
+			assert.Equal(t, tt.expected.Surname, result.Surname)
+			assert.Equal(t, tt.expected.Email, result.Email)
+			assert.Equal(t, tt.expected.PhoneNumber, result.PhoneNumber)
+			assert.Equal(t, john.Version+1, result.Version)
+		})
+	}
+}
+
+func TestPatchUserPreconditions(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", CreatedAt: time.Now()}))
+	john, err := repo.FindByEmail(ctx, "john.doe@example.com")
+	assert.NoError(t, err)
+	service := NewUserServiceImpl(repo)
+
+	var errorResponse *helper.ErrorResponse
+	_, err = service.Patch(ctx, john.Id, request.UserPatchRequest{ContentType: helper.MergePatchContentType, Patch: []byte(`{"name":"Jane"}`), Version: john.Version + 1})
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 412, errorResponse.Code)
+
+	_, err = service.Patch(ctx, uuid.New(), request.UserPatchRequest{ContentType: helper.MergePatchContentType, Patch: []byte(`{"name":"Jane"}`)})
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 404, errorResponse.Code)
+}
+
+func TestReplaceUser(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+	service := NewUserServiceImpl(repo)
+	userId := uuid.New()
+	replaceRequest := request.UserReplaceRequest{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", RequireVersion: true}
+
+	created, isNew, err := service.Replace(ctx, userId, replaceRequest)
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, userId, created.Id)
+	assert.Equal(t, int64(1), created.Version)
+
+	repeated, isNew, err := service.Replace(ctx, userId, replaceRequest)
+	assert.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, created, repeated, "repeating a replace must change nothing")
+
+	var errorResponse *helper.ErrorResponse
+	replaceRequest.Surname = "Smith"
+	_, _, err = service.Replace(ctx, userId, replaceRequest)
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 428, errorResponse.Code)
+
+	replaceRequest.Version = 1
+	replaced, isNew, err := service.Replace(ctx, userId, replaceRequest)
+	assert.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, "Smith", replaced.Surname)
+	assert.Equal(t, int64(2), replaced.Version)
+
+	_, _, err = service.Replace(ctx, userId, request.UserReplaceRequest{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001", Version: 1})
+	assert.ErrorAs(t, err, &errorResponse)
+	assert.Equal(t, 412, errorResponse.Code)
+
+	replaced, isNew, err = service.Replace(ctx, userId, request.UserReplaceRequest{Name: "Johnny", Surname: "Smith", Email: "john.doe@example.com", PhoneNumber: "5550000001", MustExist: true})
+	assert.NoError(t, err, "If-Match: * replaces a user that exists at any version")
+	assert.False(t, isNew)
+	assert.Equal(t, int64(3), replaced.Version)
+
+	audit, err := repo.AuditRepository().FindPage(ctx, repository.AuditQuery{Filter: repository.AuditFilter{UserId: &userId}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, audit.Total, "only the create and the changes are audited")
+}
+
+func TestReplaceUserErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryUserRepository(helper.EmailRules{})
+	service := NewUserServiceImpl(repo)
+
+	assert.NoError(t, repo.Save(ctx, model.User{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", PhoneNumber: "5550000002", CreatedAt: time.Now()}))
+	deletedId := uuid.New()
+	assert.NoError(t, repo.Save(ctx, model.User{Id: deletedId, Name: "Jim", Surname: "Doe", Email: "jim.doe@example.com", PhoneNumber: "5550000003", CreatedAt: time.Now()}))
+	assert.NoError(t, repo.Delete(ctx, deletedId, 1))
+
+	valid := request.UserReplaceRequest{Name: "John", Surname: "Doe", Email: "john.doe@example.com", PhoneNumber: "5550000001"}
+	tests := []struct {
+		name           string
+		userId         uuid.UUID
+		replaceRequest func(request.UserReplaceRequest) request.UserReplaceRequest
+		code           int
+	}{
+		{"missing field", uuid.New(), func(r request.UserReplaceRequest) request.UserReplaceRequest { r.Surname = ""; return r }, 400},
+		{"version of missing user", uuid.New(), func(r request.UserReplaceRequest) request.UserReplaceRequest { r.Version = 1; return r }, 412},
+		{"If-Match: * of missing user", uuid.New(), func(r request.UserReplaceRequest) request.UserReplaceRequest { r.MustExist = true; return r }, 412},
+		{"duplicate email", uuid.New(), func(r request.UserReplaceRequest) request.UserReplaceRequest { r.Email = "jane.doe@example.com"; return r }, 409},
+		{"deleted user", deletedId, func(r request.UserReplaceRequest) request.UserReplaceRequest { return r }, 409},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Replace(ctx, tt.userId, tt.replaceRequest(valid))
+
+			var errorResponse *helper.ErrorResponse
+			assert.ErrorAs(t, err, &errorResponse)
+			assert.Equal(t, tt.code, errorResponse.Code)
+		})
+	}
+}